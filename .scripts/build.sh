@@ -2,16 +2,50 @@
 
 # Just a general build command for macOS and Linux.
 # Note that `build-linux.sh` invokes this script.
+#
+# With no arguments, this builds for the machine you're on with the (faster)
+# CGO SQLite driver. Give it targets to cross-compile static binaries with the
+# pure-Go driver instead. No C toolchain needed.
+#
+#   .scripts/build.sh
+#   .scripts/build.sh linux/arm64 windows/amd64
+#   .scripts/build.sh all
 
 set -euo pipefail
 
-ARCH="$(uname -m)"
-OS="$(uname -s)"
 VERSION="$(cat VERSION)"
-ARTIFACT="dist/bock-$OS-$ARCH"
+ALL_TARGETS="linux/amd64 linux/arm64 darwin/amd64 darwin/arm64 windows/amd64 freebsd/amd64"
 
-echo "Building bock v$VERSION for $OS ($ARCH)"
-CGO_ENABLED=1 go build --tags "fts5" -o "$ARTIFACT" .
+if [ $# -eq 0 ]; then
+  ARCH="$(uname -m)"
+  OS="$(uname -s)"
+  ARTIFACT="dist/bock-$OS-$ARCH"
+
+  echo "Building bock v$VERSION for $OS ($ARCH)"
+  CGO_ENABLED=1 go build --tags "fts5" -o "$ARTIFACT" ./cmd/bock
+
+  echo "🌈 Done!"
+  echo "See $ARTIFACT"
+  exit 0
+fi
+
+TARGETS="$*"
+if [ "$TARGETS" = "all" ]; then
+  TARGETS="$ALL_TARGETS"
+fi
+
+for TARGET in $TARGETS; do
+  OS="${TARGET%/*}"
+  ARCH="${TARGET#*/}"
+  ARTIFACT="dist/bock-$OS-$ARCH"
+
+  if [ "$OS" = "windows" ]; then
+    ARTIFACT="$ARTIFACT.exe"
+  fi
+
+  echo "Building bock v$VERSION for $OS ($ARCH)"
+  CGO_ENABLED=0 GOOS="$OS" GOARCH="$ARCH" go build --tags "purego" -o "$ARTIFACT" ./cmd/bock
+done
 
 echo "🌈 Done!"
-echo "See $ARTIFACT"
+echo "See dist/"
@@ -0,0 +1,516 @@
+// Package bock turns a folder (ideally a git repository) of Markdown articles
+// into a static wiki. Build builds it once, Serve builds it and keeps it up to
+// date while serving it, and Check looks for problems in the articles without
+// building anything. All of them print what they're doing to standard output.
+package bock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// What to build and how. Only ArticleRoot and OutputFolder are required.
+type Options struct {
+	// Where the Markdown articles are. This has to be a git repository unless
+	// GenerateRevisions is false.
+	ArticleRoot string
+
+	// Read the articles from here instead of ArticleRoot on disk, like a
+	// GitTreeFS. Revisions are still read from the repository at ArticleRoot.
+	Articles fs.FS
+
+	// Where to write the wiki. If a wiki was built here before, only what
+	// changed since then is written unless RebuildEverything is true.
+	OutputFolder string
+
+	// Write the wiki here instead of OutputFolder, like a MemoryOutput or a
+	// ZipOutput
+	Output Output
+
+	// Where the wiki will be served from, like https://wiki.example.com. Only
+	// used for absolute links in the feeds.
+	BaseURL string
+
+	// A folder of templates to use on top of the built-in ones
+	TemplateFolder string
+
+	// Use ReadSiteConfig or DefaultSiteConfig. The defaults are used if this
+	// is left empty.
+	Site SiteConfig
+
+	GenerateJSON      bool
+	GenerateRaw       bool
+	GenerateRevisions bool
+
+	// How the archive page searches: SearchIndexSQLite (the default),
+	// SearchIndexJSON for hosts that can't serve `.wasm` files, or
+	// SearchIndexBoth
+	SearchIndex string
+
+	// How many articles, folders, tags, and revisions to write at once.
+	// Defaults to the number of CPUs.
+	Jobs int
+
+	RebuildEverything bool
+
+	// Read revisions with the `git` on this system instead of the built-in
+	// library, and clone the repository to disk instead of memory when using
+	// the library
+	UseGitBinary bool
+	UseOnDiskFS  bool
+
+	// Build everything that can be built instead of stopping at the first
+	// thing that can't
+	KeepGoing bool
+
+	// Check the articles before building and don't build if there are any
+	// problems
+	Strict bool
+
+	// Where to say how it's going: what's being built, warnings, and errors.
+	// Nothing is said if this is nil. Builds draw a progress bar if it's a
+	// terminal.
+	Log io.Writer
+}
+
+// What a build did
+type Result struct {
+	Articles     int
+	Folders      int
+	Tags         int
+	Revisions    int
+	FilesWritten int64
+	BytesWritten int64
+	Warnings     int64
+
+	// Everything that couldn't be built
+	Failures []BuildError
+
+	// What a strict build found wrong with the articles
+	Problems []Problem
+
+	Duration time.Duration
+	Phases   []PhaseTime
+}
+
+// What can go wrong with a build as a whole. Errors from Build, Serve, and
+// Check wrap one of these (or come from the context).
+var (
+	ErrInvalidTemplates = errors.New("there's a problem with the templates")
+	ErrBadArticleRoot   = errors.New("the article root is not a folder or does not exist")
+	ErrNotAGitRepo      = errors.New("the article root does not appear to be a git repository")
+	ErrNoArticles       = errors.New("there are no articles to build")
+	ErrOutputFolder     = errors.New("could not make the output folder")
+	ErrDatabase         = errors.New("could not update the database")
+	ErrCheckFailed      = errors.New("there are problems with the articles")
+	ErrBuildFailed      = errors.New("something could not be built")
+)
+
+// The version of bock
+func Version() string {
+	return version
+}
+
+// Fill in whatever was left out
+func (options Options) withDefaults() Options {
+	if options.Site.Home == "" {
+		options.Site = DefaultSiteConfig()
+	}
+
+	if options.Jobs < 1 {
+		options.Jobs = runtime.NumCPU()
+	}
+
+	if options.SearchIndex == "" {
+		options.SearchIndex = SearchIndexSQLite
+	}
+
+	options.ArticleRoot = strings.TrimRight(options.ArticleRoot, "/")
+	options.OutputFolder = strings.TrimRight(options.OutputFolder, "/")
+
+	if options.Articles == nil {
+		options.Articles = os.DirFS(options.ArticleRoot)
+	}
+
+	if options.Log == nil {
+		options.Log = io.Discard
+	}
+
+	return options
+}
+
+// Build the wiki once. The result says what was built and is there even if
+// the build fails partway through. Cancelling the context stops the build as
+// soon as whatever is being written right now is done.
+func Build(ctx context.Context, options Options) (*Result, error) {
+	// Some bookkeeping. Tick.
+	start := time.Now()
+	v, _ := mem.VirtualMemory()
+	stats := &buildStats{}
+	options = options.withDefaults()
+
+	result := func() *Result {
+		return stats.result(time.Since(start))
+	}
+
+	// Load templates first. There's no point in doing anything else if they're
+	// broken.
+	templates, compiled, templateErr := loadTemplates(options.TemplateFolder, options.Site)
+	if templateErr != nil {
+		return result(), fmt.Errorf("%w:\n%w", ErrInvalidTemplates, templateErr)
+	}
+
+	if !isSearchIndex(options.SearchIndex) {
+		return result(), fmt.Errorf("there's no search index called '%s'", options.SearchIndex)
+	}
+
+	// Stop and say what couldn't be built. Anything that was written is still
+	// there but there's no new manifest so the next build starts from where the
+	// last good one left off.
+	giveUp := func(err error) (*Result, error) {
+		fmt.Fprintln(options.Log, "\nStopping since something could not be built. Use --keep-going to build everything else anyway.")
+		fmt.Fprint(options.Log, stats.summary())
+
+		return result(), fmt.Errorf("%w: %w", ErrBuildFailed, err)
+	}
+
+	// Check if provided root exists
+	if info, err := fs.Stat(options.Articles, "."); err != nil || !info.IsDir() {
+		return result(), ErrBadArticleRoot
+	}
+
+	// Check if it can be read as a git repository only if we're generating
+	// revisions
+	var backend gitBackend
+	var gitErr error
+
+	if options.GenerateRevisions {
+		fmt.Fprint(options.Log, "Reading article history")
+		donePhase := stats.startPhase("Reading article history")
+
+		if options.UseGitBinary {
+			backend, gitErr = newGitCLIBackend(options.ArticleRoot)
+		} else {
+			backend, gitErr = newGoGitBackend(options.ArticleRoot, options.UseOnDiskFS)
+		}
+
+		if gitErr != nil {
+			fmt.Fprintln(options.Log)
+			return result(), fmt.Errorf("%w: %w", ErrNotAGitRepo, gitErr)
+		}
+
+		donePhase()
+		fmt.Fprintln(options.Log, "... done")
+
+		if !backend.IsClean() {
+			fmt.Fprintln(options.Log, "WARN: Working tree is not clean!")
+		}
+	} else {
+		fmt.Fprintln(options.Log, "I am not going to generate article revisions.")
+	}
+
+	// Gather basic things. Create the output folder first.
+	if options.Output == nil {
+		fmt.Fprintln(options.Log, "Making", options.OutputFolder, "if it doesn't exist")
+		if err := os.MkdirAll(options.OutputFolder, os.ModePerm); err != nil {
+			return result(), fmt.Errorf("%w: %w", ErrOutputFolder, err)
+		}
+
+		options.Output = NewDirOutput(options.OutputFolder)
+	}
+
+	// App config
+	config := bockConfig{
+		articleRoot:    options.ArticleRoot,
+		articles:       options.Articles,
+		baseURL:        options.BaseURL,
+		entityTree:     nil,
+		git:            backend,
+		listOfArticles: nil,
+		database:       nil,
+		output:         options.Output,
+		jobs:           options.Jobs,
+		meta: meta{
+			Architecture:      runtime.GOARCH,
+			ArticleCount:      0,
+			BuildDate:         time.Now().UTC(),
+			CPUCount:          runtime.NumCPU(),
+			GenerateJSON:      options.GenerateJSON,
+			GenerateRaw:       options.GenerateRaw,
+			GenerateRevisions: options.GenerateRevisions,
+			GenerationTime:    0,
+			SearchIndex:       options.SearchIndex,
+			MemoryInGB:        int(v.Total / (1024 * 1024 * 1024)),
+			Platform:          runtime.GOOS,
+			RevisionCount:     0,
+		},
+		started:   time.Now(),
+		stats:     stats,
+		site:      options.Site,
+		templates: templates,
+		compiled:  compiled,
+		keepGoing: options.KeepGoing,
+		ctx:       ctx,
+		log:       options.Log,
+	}
+
+	// Pages that aren't articles, folders, or tags fail the same way. Returns
+	// an error if we should stop.
+	writeOther := func(name string, write func(*bockConfig) error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		fmt.Fprint(options.Log, "Writing "+name)
+
+		if err := write(&config); err != nil {
+			fmt.Fprintln(options.Log, "; ERROR:", err)
+			stats.fail(name, err)
+
+			if !options.KeepGoing {
+				return BuildError{Name: name, Err: err}
+			}
+
+			return nil
+		}
+
+		fmt.Fprintln(options.Log, "... done")
+
+		return nil
+	}
+
+	// Make a flat list of absolute article paths. Use these to build the entity
+	// tree. We do this to prevent unnecessary and empty folders from being
+	// created.
+	donePhase := stats.startPhase("Finding articles")
+	listOfArticles, listOfFolders, _ := makeListOfEntities(&config)
+
+	// Do we even build anything?
+	if len(listOfArticles) == 0 {
+		return result(), ErrNoArticles
+	}
+
+	// We have things to build. Continue configuring.
+	config.listOfArticles = &listOfArticles
+	config.listOfFolders = &listOfFolders
+	config.meta.ArticleCount = len(listOfArticles)
+	config.meta.FolderCount = len(listOfFolders)
+
+	fmt.Fprintln(options.Log, "Found", config.meta.ArticleCount, "articles")
+
+	listOfTags := makeListOfTags(&config)
+	config.listOfTags = &listOfTags
+	config.meta.TagCount = len(listOfTags)
+
+	// Wiki links can point at any article
+	config.wikiLinks = makeWikiLinkIndex(&config)
+
+	// Make a tree of entities: articles and folders
+	entityTree := makeEntityTree(&config)
+	config.entityTree = &entityTree
+	donePhase()
+
+	// Every article lists what links to it, so we need all links up front
+	donePhase = stats.startPhase("Finding links")
+	config.links = makeLinkGraph(&config)
+	donePhase()
+
+	// Don't write anything if there are problems and we were asked to be strict
+	if options.Strict {
+		if problems := findProblems(&config); len(problems) > 0 {
+			r := result()
+			r.Problems = problems
+
+			return r, ErrCheckFailed
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return result(), err
+	}
+
+	// Figure out if we can build on top of a previous build. We can't if the
+	// templates or flags changed, or if the database has to be recreated.
+	templateVersion := makeTemplateVersion(&config)
+	previousManifest := readManifest(&config)
+
+	if options.RebuildEverything || previousManifest == nil || previousManifest.TemplateVersion != templateVersion {
+		previousManifest = nil
+	}
+
+	// Database setup
+	donePhase = stats.startPhase("Setting up the database")
+	db, rebuiltDatabase, dbErr := makeDatabase(&config, previousManifest == nil)
+	if dbErr != nil {
+		return result(), fmt.Errorf("%w: %w", ErrDatabase, dbErr)
+	}
+
+	defer func() {
+		db.Close()
+
+		if config.databaseFile != "" {
+			os.Remove(config.databaseFile)
+		}
+	}()
+
+	config.database = db
+	removeOtherSearchIndexes(&config)
+
+	if rebuiltDatabase {
+		previousManifest = nil
+	}
+
+	config.previousManifest = previousManifest
+	config.manifest = &manifest{
+		Articles:        make(map[string]manifestEntry),
+		TemplateVersion: templateVersion,
+		Version:         version,
+	}
+
+	if previousManifest != nil {
+		fmt.Fprintln(options.Log, "Only writing what changed since the last build")
+
+		if err := removeStaleOutput(&config); err != nil {
+			return result(), fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+	}
+
+	donePhase()
+
+	// Copy static assets over
+	donePhase = stats.startPhase("Copying assets")
+	if err := writeOther("template assets", copyTemplateAssets); err != nil {
+		return giveUp(err)
+	}
+
+	// Not every wiki has assets. Anything else that goes wrong is an error.
+	if _, err := fs.Stat(config.articles, assetsFolder); errors.Is(err, fs.ErrNotExist) {
+		fmt.Fprintln(options.Log, "Could not find '"+assetsFolder+"' in repository. Ignoring.")
+	} else if err := writeOther("assets", copyAssets); err != nil {
+		return giveUp(err)
+	}
+
+	donePhase()
+
+	// Process all articles, folders, and tags
+	donePhase = stats.startPhase("Writing entities")
+	if err := writeEntities(&config); err != nil {
+		switch {
+		case errors.As(err, &BuildError{}):
+			return giveUp(err)
+		case ctx.Err() != nil:
+			return result(), ctx.Err()
+		default:
+			return result(), fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+	}
+
+	donePhase()
+
+	// Write the index page and other pages
+	donePhase = stats.startPhase("Writing other pages")
+	type page struct {
+		name  string
+		write func(*bockConfig) error
+	}
+
+	pages := []page{
+		{"index page", writeIndex},
+		{"404 page", write404},
+		{"archive page", writeArchive},
+		{"tags page", writeTagList},
+	}
+
+	if config.meta.GenerateRevisions {
+		pages = append(pages, page{"recent changes and feeds", writeRecentChanges})
+	}
+
+	if config.meta.searchesJSON() {
+		pages = append(pages, page{"search index", writeJSONSearchIndex})
+	}
+
+	pages = append(pages, page{"tree", writeTree}, page{"random page", writeRandom})
+
+	for _, page := range pages {
+		if err := writeOther(page.name, page.write); err != nil {
+			if ctx.Err() != nil {
+				return result(), err
+			}
+
+			return giveUp(err)
+		}
+	}
+	donePhase()
+
+	// Tock
+	end := time.Now()
+	generationTime := end.Sub(start)
+	config.meta.GenerationTime = generationTime
+	config.meta.GenerationTimeRounded = generationTime.Round(time.Second)
+
+	donePhase = stats.startPhase("Writing " + options.Site.HomeURI)
+	if err := writeHome(&config); err != nil {
+		if ctx.Err() != nil {
+			return result(), ctx.Err()
+		}
+
+		if !errors.As(err, &BuildError{}) {
+			stats.fail(options.Site.HomeURI, err)
+		}
+
+		if !options.KeepGoing {
+			return giveUp(err)
+		}
+	}
+
+	// Whatever failed is left out of the manifest so it's tried again. Outputs
+	// we can't read it back from (like archives) don't get one at all.
+	if _, err := fs.Stat(config.output, "."); err == nil {
+		if err := writeManifest(&config); err != nil {
+			stats.fail(manifestName, err)
+		}
+	}
+	donePhase()
+
+	// The database describes the whole build so it comes last
+	donePhase = stats.startPhase("Finishing the database")
+	if err := writeDatabaseMeta(&config); err != nil {
+		return result(), fmt.Errorf("%w: %w", ErrDatabase, err)
+	}
+
+	// The private database is only there for the next build, and there's no
+	// building on top of outputs we can't read the manifest back from
+	_, manifestErr := fs.Stat(config.output, manifestName)
+	keepDatabase := config.meta.searchesDatabase() || manifestErr == nil
+
+	if config.databaseFile != "" && keepDatabase {
+		if err := saveDatabase(&config); err != nil {
+			return result(), fmt.Errorf("%w: %w", ErrDatabase, err)
+		}
+	}
+	donePhase()
+
+	fmt.Fprintf(options.Log,
+		"\nDone! Finished processing %d articles, %d folders, and %d revisions in %s\n",
+		config.meta.ArticleCount,
+		config.meta.FolderCount,
+		config.meta.RevisionCount,
+		config.meta.GenerationTime,
+	)
+	fmt.Fprint(options.Log, stats.summary())
+
+	if failures := stats.failed(); len(failures) > 0 {
+		return result(), fmt.Errorf("%w: %d things failed", ErrBuildFailed, len(failures))
+	}
+
+	return result(), nil
+}
@@ -0,0 +1,227 @@
+package bock
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// A folder of articles (not a git repository) to build
+func makeTestWiki(t *testing.T, articles map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+
+	for name, contents := range articles {
+		p := filepath.Join(root, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(p, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+// Builds in the same process don't share templates or site configs
+func TestConcurrentBuilds(t *testing.T) {
+	root := makeTestWiki(t, map[string]string{
+		"Home.md":  "# Home\n",
+		"Notes.md": "# Notes\n",
+	})
+
+	var wg sync.WaitGroup
+
+	for _, title := range []string{"First Wiki", "Second Wiki"} {
+		title := title
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 3; i++ {
+				site := DefaultSiteConfig()
+				site.Title = title
+				output := NewMemoryOutput()
+
+				if _, err := Build(context.Background(), Options{
+					ArticleRoot: root,
+					Output:      output,
+					Site:        site,
+				}); err != nil {
+					t.Errorf("could not build %s: %v", title, err)
+					return
+				}
+
+				page, err := fs.ReadFile(output, "Notes/index.html")
+				if err != nil {
+					t.Errorf("%s has no Notes: %v", title, err)
+					return
+				}
+
+				if !strings.Contains(string(page), "Notes &ndash; "+title) {
+					t.Errorf("%s's Notes page has the wrong title", title)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// Every page gets the links that depend on what was built, not just articles
+func TestNavigationLinks(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("there's no git")
+	}
+
+	root := makeTestRepository(t, "")
+
+	if err := os.MkdirAll(filepath.Join(root, "Tech"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "Tech", "pf.md"), []byte("---\ntags: [BSD]\n---\n# pf\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := NewMemoryOutput()
+
+	if _, err := Build(context.Background(), Options{
+		ArticleRoot:       root,
+		Output:            output,
+		GenerateRevisions: true,
+		UseOnDiskFS:       true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	links := []string{`href="/recent"`, `href="/tags"`, `href="/feed.atom"`, `href="/feed.rss"`}
+
+	for _, page := range []string{"Tech/index.html", "404.html", "random/index.html", "New/index.html"} {
+		contents, err := fs.ReadFile(output, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, link := range links {
+			if !strings.Contains(string(contents), link) {
+				t.Errorf("%s doesn't have %s", page, link)
+			}
+		}
+	}
+}
+
+// `__assets` is optional, but one that can't be copied fails the build
+func TestCopyAssets(t *testing.T) {
+	root := makeTestWiki(t, map[string]string{
+		"Home.md":             "# Home\n",
+		"Notes.md":            "# Notes\n",
+		"__assets/img/pf.svg": "<svg></svg>",
+	})
+
+	output := NewMemoryOutput()
+
+	if _, err := Build(context.Background(), Options{ArticleRoot: root, Output: output}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.Stat(output, "assets/img/pf.svg"); err != nil {
+		t.Errorf("the assets weren't copied: %v", err)
+	}
+
+	if err := os.Symlink("nowhere.svg", filepath.Join(root, "__assets", "broken.svg")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Build(context.Background(), Options{ArticleRoot: root, Output: NewMemoryOutput()}); err == nil {
+		t.Errorf("a broken asset didn't fail the build")
+	}
+
+	if err := os.RemoveAll(filepath.Join(root, "__assets")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Build(context.Background(), Options{ArticleRoot: root, Output: NewMemoryOutput()}); err != nil {
+		t.Errorf("a wiki without assets didn't build: %v", err)
+	}
+}
+
+// Only outputs that the next build can read from get a manifest
+func TestManifestOnlyInReadableOutputs(t *testing.T) {
+	root := makeTestWiki(t, map[string]string{
+		"Home.md":  "# Home\n",
+		"Notes.md": "# Notes\n",
+	})
+
+	memory := NewMemoryOutput()
+	if _, err := Build(context.Background(), Options{ArticleRoot: root, Output: memory}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.Stat(memory, manifestName); err != nil {
+		t.Errorf("there's no manifest in memory: %v", err)
+	}
+
+	var archive bytes.Buffer
+	tarOutput := NewTarOutput(&archive)
+
+	if _, err := Build(context.Background(), Options{ArticleRoot: root, Output: tarOutput}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tarOutput.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := tar.NewReader(&archive)
+	for {
+		header, err := files.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		if header.Name == manifestName {
+			t.Errorf("there's a manifest in the archive")
+		}
+	}
+}
+
+// Builds only say how they're going where they're told to. That isn't a
+// terminal here so there's no progress bar, just how far along each batch got.
+func TestBuildLog(t *testing.T) {
+	root := makeTestWiki(t, map[string]string{
+		"Home.md":  "# Home\n",
+		"Notes.md": "# Notes\n",
+	})
+
+	var log bytes.Buffer
+
+	if _, err := Build(context.Background(), Options{ArticleRoot: root, Output: NewMemoryOutput(), Log: &log}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"Found 1 articles\n", "Writing entities: 2/2\n", "\nDone!"} {
+		if !strings.Contains(log.String(), want) {
+			t.Errorf("%q isn't in the log:\n%s", want, log.String())
+		}
+	}
+
+	if strings.Contains(log.String(), "\033") {
+		t.Errorf("there's a progress bar in the log:\n%s", log.String())
+	}
+}
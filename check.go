@@ -0,0 +1,321 @@
+package bock
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// `bock check` (and builds with `--strict`) look for things in articles that
+// won't work once the wiki is built: links to pages that won't exist, assets
+// that aren't in `__assets`, and images without alt text. Articles that can't
+// be read or whose frontmatter can't be parsed are problems too.
+
+const (
+	ProblemBrokenLink   = "broken-link"
+	ProblemMissingAsset = "missing-asset"
+	ProblemEmptyAlt     = "empty-alt"
+
+	// The target is what went wrong
+	ProblemInvalidArticle = "invalid-article"
+)
+
+type Problem struct {
+	Article string `json:"article"`
+	Line    int    `json:"line"`
+	Kind    string `json:"kind"`
+	Target  string `json:"target"`
+}
+
+func (p Problem) String() string {
+	where := fmt.Sprintf("%s:%d", p.Article, p.Line)
+
+	switch p.Kind {
+	case ProblemMissingAsset:
+		return fmt.Sprintf("%s: %s is not in %s", where, p.Target, assetsFolder)
+	case ProblemEmptyAlt:
+		return fmt.Sprintf("%s: the image %s has no alt text", where, p.Target)
+	case ProblemInvalidArticle:
+		return fmt.Sprintf("%s: %s", where, p.Target)
+	default:
+		return fmt.Sprintf("%s: there is nothing at %s", where, p.Target)
+	}
+}
+
+// Every page we're going to write that isn't under an article
+func makeListOfPages(config *bockConfig) map[string]bool {
+	pages := map[string]bool{
+		"/":          true,
+		"/404.html":  true,
+		"/archive":   true,
+		"/random":    true,
+		"/tags":      true,
+		"/tree.json": true,
+	}
+
+	if config.meta.GenerateRevisions {
+		pages["/recent"] = true
+		pages["/feed.atom"] = true
+		pages["/feed.rss"] = true
+	}
+
+	if config.meta.searchesDatabase() {
+		pages["/"+publicDatabaseName] = true
+	}
+
+	if config.meta.searchesJSON() {
+		pages["/"+searchIndexFolder+"/index.json"] = true
+	}
+
+	for _, f := range *config.listOfFolders {
+		pages[makeFolderURI(f, config)] = true
+	}
+
+	for _, t := range *config.listOfTags {
+		pages[t.URI] = true
+	}
+
+	return pages
+}
+
+// Whether a (cleaned up) URI is something we'll write. Articles have a few
+// pages of their own, depending on what we're generating.
+func isKnownURI(uri string, articles map[string]bool, pages map[string]bool, config *bockConfig) bool {
+	if articles[uri] || pages[uri] {
+		return true
+	}
+
+	parent, name := path.Split(uri)
+	parent = strings.TrimSuffix(parent, "/")
+
+	switch name {
+	case "index.html":
+		return articles[parent] || pages[parent]
+	case "index.json":
+		return config.meta.GenerateJSON && (articles[parent] || pages[parent])
+	case "raw.txt":
+		return config.meta.GenerateRaw && articles[parent]
+	}
+
+	// Which shards the search index has depends on the words in the articles,
+	// which we don't know until they're all in the database
+	if parent == "/"+searchIndexFolder && path.Ext(name) == ".json" {
+		return config.meta.searchesJSON()
+	}
+
+	if i := strings.Index(uri, "/revisions"); i > 0 && config.meta.GenerateRevisions {
+		rest := uri[i+len("/revisions"):]
+		return articles[uri[:i]] && (rest == "" || strings.HasPrefix(rest, "/"))
+	}
+
+	// Stylesheets, scripts, and images from the templates
+	if _, err := fs.Stat(config.templates, strings.TrimPrefix(uri, "/")); err == nil {
+		return true
+	}
+
+	return false
+}
+
+// Where an internal link or image leads, without its fragment or query
+func internalDestination(destination string) (string, bool) {
+	if !strings.HasPrefix(destination, "/") || strings.HasPrefix(destination, "//") {
+		return "", false
+	}
+
+	destination, _, _ = strings.Cut(destination, "#")
+	destination, _, _ = strings.Cut(destination, "?")
+
+	if unescaped, err := url.PathUnescape(destination); err == nil {
+		destination = unescaped
+	}
+
+	if destination != "/" {
+		destination = strings.TrimSuffix(destination, "/")
+	}
+
+	return destination, true
+}
+
+// Which line of the file an inline node is on. Inline nodes don't know where
+// they are so we ask the block they're in.
+func lineOf(node ast.Node, source []byte, offset int) int {
+	for n := node; n != nil; n = n.Parent() {
+		if n.Type() == ast.TypeBlock && n.Lines().Len() > 0 {
+			start := n.Lines().At(0).Start
+			return bytes.Count(source[:offset+start], newline) + 1
+		}
+	}
+
+	return 1
+}
+
+// Look through every article for problems. They're sorted by article and line.
+func findProblems(config *bockConfig) []Problem {
+	problems := []Problem{}
+
+	articles := map[string]bool{config.site.HomeURI: true}
+	paths := map[string]string{}
+
+	// There's a placeholder if there's no Home article
+	home := config.site.Home + ".md"
+	if _, err := fs.Stat(config.articles, home); err == nil {
+		paths[home] = config.articleRoot + "/" + home
+	}
+
+	for _, a := range *config.listOfArticles {
+		articles[a.URI] = true
+		paths[a.RelativePath] = a.path
+	}
+
+	pages := makeListOfPages(config)
+
+	for relativePath, articlePath := range paths {
+		source, err := readArticleFile(articlePath, config)
+		if err != nil {
+			problems = append(problems, Problem{
+				Article: relativePath,
+				Line:    1,
+				Kind:    ProblemInvalidArticle,
+				Target:  "could not read the article: " + err.Error(),
+			})
+
+			continue
+		}
+
+		// The article is still built (without its frontmatter) so it's still
+		// worth checking the rest of it
+		if _, _, fmError := parseFrontmatter(source); fmError != nil {
+			problems = append(problems, Problem{
+				Article: relativePath,
+				Line:    1,
+				Kind:    ProblemInvalidArticle,
+				Target:  fmError.Error(),
+			})
+		}
+
+		// Line numbers count the frontmatter too
+		document, body, offset := parseArticleContents(source, config)
+
+		report := func(node ast.Node, kind string, target string) {
+			problems = append(problems, Problem{
+				Article: relativePath,
+				Line:    lineOf(node, source, offset),
+				Kind:    kind,
+				Target:  target,
+			})
+		}
+
+		ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+			if !entering {
+				return ast.WalkContinue, nil
+			}
+
+			var destination string
+
+			switch n := node.(type) {
+			case *wikiLink:
+				if n.Missing {
+					report(n, ProblemBrokenLink, n.Destination)
+				}
+
+				return ast.WalkContinue, nil
+
+			case *ast.Link:
+				destination = string(n.Destination)
+
+			case *ast.Image:
+				destination = string(n.Destination)
+
+				if strings.TrimSpace(string(n.Text(body))) == "" {
+					report(n, ProblemEmptyAlt, destination)
+				}
+
+			default:
+				return ast.WalkContinue, nil
+			}
+
+			uri, ok := internalDestination(destination)
+			if !ok {
+				return ast.WalkContinue, nil
+			}
+
+			if strings.HasPrefix(uri, "/assets/") {
+				asset := assetsFolder + "/" + strings.TrimPrefix(uri, "/assets/")
+				if _, err := fs.Stat(config.articles, asset); err != nil {
+					report(node, ProblemMissingAsset, destination)
+				}
+			} else if !isKnownURI(uri, articles, pages, config) {
+				report(node, ProblemBrokenLink, destination)
+			}
+
+			return ast.WalkContinue, nil
+		})
+	}
+
+	sort.Slice(problems, func(i, j int) bool {
+		if problems[i].Article != problems[j].Article {
+			return problems[i].Article < problems[j].Article
+		}
+
+		return problems[i].Line < problems[j].Line
+	})
+
+	return problems
+}
+
+// Check the articles without building anything. Returns what's wrong with
+// them, along with ErrCheckFailed if that's anything at all.
+func Check(ctx context.Context, options Options) ([]Problem, error) {
+	options = options.withDefaults()
+
+	templates, compiled, templateErr := loadTemplates(options.TemplateFolder, options.Site)
+	if templateErr != nil {
+		return nil, fmt.Errorf("%w:\n%w", ErrInvalidTemplates, templateErr)
+	}
+
+	if info, err := fs.Stat(options.Articles, "."); err != nil || !info.IsDir() {
+		return nil, ErrBadArticleRoot
+	}
+
+	config := bockConfig{
+		articleRoot: options.ArticleRoot,
+		articles:    options.Articles,
+		meta: meta{
+			GenerateJSON:      options.GenerateJSON,
+			GenerateRaw:       options.GenerateRaw,
+			GenerateRevisions: options.GenerateRevisions,
+			SearchIndex:       options.SearchIndex,
+		},
+		site:      options.Site,
+		templates: templates,
+		compiled:  compiled,
+		ctx:       ctx,
+		log:       options.Log,
+	}
+
+	listOfArticles, listOfFolders, _ := makeListOfEntities(&config)
+	config.listOfArticles = &listOfArticles
+	config.listOfFolders = &listOfFolders
+
+	listOfTags := makeListOfTags(&config)
+	config.listOfTags = &listOfTags
+	config.wikiLinks = makeWikiLinkIndex(&config)
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	problems := findProblems(&config)
+	if len(problems) > 0 {
+		return problems, ErrCheckFailed
+	}
+
+	return problems, nil
+}
@@ -0,0 +1,91 @@
+package bock
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	root := makeTestWiki(t, map[string]string{
+		"Home.md":   "# Home\n\n[Notes](/Notes)\n",
+		"Notes.md":  "# Notes\n",
+		"Broken.md": "---\ntags: [one\n---\n\n# Broken\n",
+		"Links.md":  "# Links\n\n[Nowhere](/Nowhere)\n",
+	})
+
+	problems, err := Check(context.Background(), Options{ArticleRoot: root})
+	if !errors.Is(err, ErrCheckFailed) {
+		t.Fatalf("got %v, want %v", err, ErrCheckFailed)
+	}
+
+	want := []struct {
+		article string
+		kind    string
+	}{
+		{"Broken.md", ProblemInvalidArticle},
+		{"Links.md", ProblemBrokenLink},
+	}
+
+	if len(problems) != len(want) {
+		t.Fatalf("got %d problems (%v), want %d", len(problems), problems, len(want))
+	}
+
+	for i, w := range want {
+		if problems[i].Article != w.article || problems[i].Kind != w.kind {
+			t.Errorf("problem %d is %v, want a %s in %s", i, problems[i], w.kind, w.article)
+		}
+	}
+}
+
+// Links to pages that only some builds write are only fine in those builds
+func TestCheckPages(t *testing.T) {
+	root := makeTestWiki(t, map[string]string{
+		"Home.md":  "# Home\n",
+		"Links.md": "# Links\n\n[Recent](/recent) [Feed](/feed.atom) [Database](/articles.db) [Search](/search/index.json) [Shard](/search/pf.json)\n",
+	})
+
+	tests := []struct {
+		name    string
+		options Options
+		broken  []string
+	}{
+		{
+			name:    "with revisions",
+			options: Options{GenerateRevisions: true},
+			broken:  []string{"/search/index.json", "/search/pf.json"},
+		},
+		{
+			name:    "without revisions",
+			options: Options{},
+			broken:  []string{"/recent", "/feed.atom", "/search/index.json", "/search/pf.json"},
+		},
+		{
+			name:    "with the JSON search index",
+			options: Options{GenerateRevisions: true, SearchIndex: SearchIndexJSON},
+			broken:  []string{"/articles.db"},
+		},
+		{
+			name:    "with both search indexes",
+			options: Options{GenerateRevisions: true, SearchIndex: SearchIndexBoth},
+			broken:  []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.options.ArticleRoot = root
+			problems, _ := Check(context.Background(), tt.options)
+
+			broken := []string{}
+			for _, p := range problems {
+				broken = append(broken, p.Target)
+			}
+
+			if !reflect.DeepEqual(broken, tt.broken) {
+				t.Errorf("got broken links to %q, want %q", broken, tt.broken)
+			}
+		})
+	}
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"afreeorange/bock"
+)
+
+// Where `bock serve` listens unless you say otherwise
+const DEFAULT_PORT = 8080
+
+// Exit codes
+const (
+	EXIT_BAD_ARTICLE_ROOT int = iota + 10
+	EXIT_DATABASE_ERROR
+	EXIT_GENERAL_IO_ERROR
+	EXIT_NO_ARTICLE_ROOT
+	EXIT_NO_OUTPUT_FOLDER
+	EXIT_NOT_A_GIT_REPO
+	EXIT_NO_ARTICLES_TO_RENDER
+	EXIT_COULD_NOT_GENERATE_LIST_OF_ENTITIES
+	EXIT_COULD_NOT_WRITE_ENTITY_TREE
+	EXIT_COULD_NOT_CREATE_OUTPUT_FOLDER
+	EXIT_INVALID_FLAG_SUPPLIED
+	EXIT_INVALID_TEMPLATES
+	EXIT_INVALID_SITE_CONFIG
+	EXIT_CHECK_FAILED
+	EXIT_BUILD_FAILED
+)
+
+func logo() {
+	fmt.Println("     __               __       ")
+	fmt.Println("    / /_  ____  _____/ /__     ")
+	fmt.Println("   / __ \\/ __ \\/ ___/ //_/   ")
+	fmt.Println("  / /_/ / /_/ / /__/ ,<        ")
+	fmt.Println(" /_.___/\\____/\\___/_/|_|     ")
+	fmt.Println(" v" + bock.Version() + "              ")
+	fmt.Println("                               ")
+}
+
+var help = `
+bock [serve|check] --in=<path> [--out=<path>] [options]
+
+serve                       Build the wiki, serve it at http://localhost:8080,
+                            and rebuild it whenever an article, anything in
+                            '__assets', or one of your templates changes. Open
+                            pages reload themselves.
+                            The wiki is built in memory unless you give me
+                            an output folder.
+
+check                       Look for broken links, assets that aren't in
+                            '__assets', and images without alt text in your
+                            articles without building anything. Exits with
+                            code 23 if there are any.
+
+--json                      Print what 'check' found as JSON.
+
+--strict                    Check the articles (like 'check') before
+                            building and stop if there are any problems.
+
+--port=<number>             Which port to serve the wiki on. Only used with
+                            'serve'. Defaults to 8080.
+
+--in=<path>                 Absolute path to where your markdown articles are
+                            stored. This is expected to be a git repository.
+                            If it is not, you must supply the
+                            --without-revisions flag to generate your wiki.
+
+--out=<path>                Where to write the output. If you've built your
+                            wiki here before, I'll only update what changed.
+                            Paths ending in '.zip', '.tar', or '.tar.gz' get
+                            an archive of the wiki instead of a folder.
+
+--revision=<rev>            Build the articles as they are in this commit,
+                            branch, or tag instead of what's on disk. Nothing
+                            is checked out so this works with bare
+                            repositories.
+
+--base-url=<url>            Where the wiki will be served from, like
+                            https://wiki.example.com. Only used to make
+                            absolute links in the Atom and RSS feeds.
+
+--config=<path>             Where your site config is. By default, I look
+                            for 'bock.yaml' in your article root. See the
+                            README for what goes in it.
+
+--templates=<path>          A folder of templates to use instead of the
+                            built-in ones. Anything that isn't in there (a
+                            template, stylesheet, script, or image) comes from
+                            the built-in set.
+
+--with-json-files           Generate JSON source files. None are generated
+                            by default.
+
+--with-raw-markdown-files   Generate raw markdown source files. None are
+                            generated by default.
+
+--search-index=<kind>       How the archive page searches your articles:
+                            'sqlite' downloads 'articles.db' and searches it
+                            with SQLite compiled to WebAssembly, 'json' uses
+                            a prebuilt index of small JSON files for hosts
+                            that can't serve '.wasm' files, and 'both'
+                            writes both and uses SQLite where it can.
+                            Defaults to 'sqlite'.
+
+--without-revisions         Do not article revisions based on git history.
+                            These are generated by default. This is a *much*
+                            faster option if you're not that interested in
+                            viewing article revision histories.
+
+--using-disk-fs             Use on-disk filesystem to clone your article
+                            repository. This is slower; your repo is cloned
+                            to memory by default.
+
+--using-git-binary          Read revisions with the 'git' installed on
+                            your system instead of the built-in library.
+                            This is *much* faster with large repositories.
+                            Your article root must be a working tree on disk.
+
+--jobs=<number>             How many articles, folders, and revisions to
+                            write at the same time. Defaults to the number
+                            of CPUs you have.
+
+--fail-fast                 Stop at the first article, folder, tag, or page
+                            that can't be built. This is what I do by
+                            default.
+
+--keep-going                Build everything that can be built even if some
+                            things can't. What failed is listed at the end
+                            and I still exit with code 24.
+
+--rebuild-everything        Ignore what was built the last time and build
+                            everything from scratch. By default, only the
+                            articles that changed since the last build (into
+                            the same output folder) are written.
+
+--version                   Show version
+
+--help                      Show this message
+`
+
+// What the command line (and the flags in the site config) asked for
+type commandLine struct {
+	configFile string
+	json       bool
+	options    bock.Options
+	port       int
+	revision   string
+}
+
+func main() {
+	// Parse arguments as longopts. Yes, there's the `flags` package but I like
+	// double dashes for my flags.
+	args := os.Args[1:]
+
+	if len(args) == 0 {
+		logo()
+		fmt.Println(help)
+		os.Exit(0)
+	}
+
+	// `bock serve ...` serves the wiki instead of just building it
+	// `bock check ...` only checks the articles
+	command := ""
+	if args[0] == "serve" || args[0] == "check" {
+		command = args[0]
+		args = args[1:]
+	}
+
+	cli := parseFlags(args, nil)
+
+	// The site config lives in the article root unless you say otherwise
+	configFile := cli.configFile
+	if configFile == "" && cli.options.ArticleRoot != "" {
+		configFile = strings.TrimRight(cli.options.ArticleRoot, "/") + "/" + bock.SiteConfigName
+	}
+
+	// Articles from a revision come with the site config in that revision
+	var articles fs.FS
+
+	if cli.revision != "" && cli.options.ArticleRoot != "" {
+		var err error
+
+		articles, err = bock.GitTreeFS(cli.options.ArticleRoot, cli.revision)
+		if err != nil {
+			fmt.Println("ERROR: Could not read", cli.revision, "in", cli.options.ArticleRoot+":", err)
+			os.Exit(EXIT_NOT_A_GIT_REPO)
+		}
+	}
+
+	var site bock.SiteConfig
+	var siteErr error
+
+	if articles != nil && cli.configFile == "" {
+		site, siteErr = bock.ReadSiteConfigFS(articles, bock.SiteConfigName, false)
+	} else {
+		site, siteErr = bock.ReadSiteConfig(configFile, cli.configFile != "")
+	}
+
+	if siteErr != nil {
+		fmt.Println("ERROR: Could not read the site config:", siteErr)
+		os.Exit(EXIT_INVALID_SITE_CONFIG)
+	}
+
+	// Flags in the site config are defaults. Anything on the command line wins.
+	if len(site.Flags) > 0 {
+		cli = parseFlags(args, site.Flags)
+	}
+
+	cli.options.Articles = articles
+	cli.options.Site = site
+	if cli.options.BaseURL == "" {
+		cli.options.BaseURL = site.BaseURL
+	}
+
+	if cli.options.ArticleRoot == "" {
+		fmt.Println("You must give me an article root (--in=<path>)")
+		os.Exit(EXIT_NO_ARTICLE_ROOT)
+	}
+
+	// Ctrl+C stops whatever we're doing
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch command {
+	case "serve":
+		if err := bock.Serve(ctx, cli.options, cli.port); err != nil {
+			exit(err)
+		}
+
+		return
+
+	case "check":
+		problems, err := bock.Check(ctx, cli.options)
+		printProblems(problems, cli.json)
+
+		if err != nil {
+			if errors.Is(err, bock.ErrCheckFailed) {
+				os.Exit(EXIT_CHECK_FAILED)
+			}
+
+			exit(err)
+		}
+
+		return
+	}
+
+	if cli.options.OutputFolder == "" {
+		fmt.Println("You must give me an output folder (--out=<path>)")
+		os.Exit(EXIT_NO_OUTPUT_FOLDER)
+	}
+
+	output, closeOutput, err := makeArchiveOutput(cli.options.OutputFolder)
+	if err != nil {
+		fmt.Println("ERROR: Could not make", cli.options.OutputFolder+":", err)
+		os.Exit(EXIT_COULD_NOT_CREATE_OUTPUT_FOLDER)
+	}
+
+	cli.options.Output = output
+
+	result, err := bock.Build(ctx, cli.options)
+
+	// Archives are only done once they're closed
+	if closeErr := closeOutput(); closeErr != nil && err == nil {
+		err = fmt.Errorf("%w: %w", bock.ErrOutputFolder, closeErr)
+	}
+
+	if err != nil {
+		if len(result.Problems) > 0 {
+			fmt.Println("ERROR: I found some problems with your articles:")
+			printProblems(result.Problems, false)
+		}
+
+		exit(err)
+	}
+}
+
+// An archive if that's what the output folder looks like. Otherwise there's no
+// output and the build writes to the folder. Close the archive when the build
+// is done.
+func makeArchiveOutput(name string) (bock.Output, func() error, error) {
+	isTarGz := strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+	isTar := strings.HasSuffix(name, ".tar")
+	isZip := strings.HasSuffix(name, ".zip")
+
+	if !isTarGz && !isTar && !isZip {
+		return nil, func() error { return nil }, nil
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case isZip:
+		output := bock.NewZipOutput(f)
+		return output, func() error { return errors.Join(output.Close(), f.Close()) }, nil
+
+	case isTar:
+		output := bock.NewTarOutput(f)
+		return output, func() error { return errors.Join(output.Close(), f.Close()) }, nil
+
+	default:
+		compressed := gzip.NewWriter(f)
+		output := bock.NewTarOutput(compressed)
+		return output, func() error { return errors.Join(output.Close(), compressed.Close(), f.Close()) }, nil
+	}
+}
+
+// Say what went wrong and exit with the code for it
+func exit(err error) {
+	switch {
+	case errors.Is(err, context.Canceled):
+		fmt.Println("\nStopped.")
+		os.Exit(0)
+
+	case errors.Is(err, bock.ErrInvalidTemplates):
+		fmt.Println("ERROR:", err)
+		os.Exit(EXIT_INVALID_TEMPLATES)
+
+	case errors.Is(err, bock.ErrBadArticleRoot):
+		fmt.Println("That article root is not a folder or does not exist.")
+		os.Exit(EXIT_BAD_ARTICLE_ROOT)
+
+	case errors.Is(err, bock.ErrNotAGitRepo):
+		fmt.Println("ERROR:", err)
+		fmt.Println("You can try running me again with '--without-revisions' and I won't check if it's a git repository.")
+		os.Exit(EXIT_NOT_A_GIT_REPO)
+
+	case errors.Is(err, bock.ErrNoArticles):
+		fmt.Println("I could not find any articles to render :/")
+		fmt.Println("Quitting.")
+		os.Exit(EXIT_NO_ARTICLES_TO_RENDER)
+
+	case errors.Is(err, bock.ErrOutputFolder):
+		fmt.Println("ERROR:", err)
+		os.Exit(EXIT_COULD_NOT_CREATE_OUTPUT_FOLDER)
+
+	case errors.Is(err, bock.ErrDatabase):
+		fmt.Println("ERROR:", err)
+		os.Exit(EXIT_DATABASE_ERROR)
+
+	case errors.Is(err, bock.ErrCheckFailed):
+		os.Exit(EXIT_CHECK_FAILED)
+
+	case errors.Is(err, bock.ErrBuildFailed):
+		// The build already said what failed
+		os.Exit(EXIT_BUILD_FAILED)
+
+	default:
+		fmt.Println("ERROR:", err)
+		os.Exit(EXIT_GENERAL_IO_ERROR)
+	}
+}
+
+func printProblems(problems []bock.Problem, asJSON bool) {
+	if asJSON {
+		data, _ := json.MarshalIndent(problems, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+
+	if len(problems) == 0 {
+		fmt.Println("No problems found")
+	} else {
+		fmt.Println(len(problems), "problems found")
+	}
+}
+
+// Parse flags on top of some defaults (which are also flags)
+func parseFlags(args []string, defaults []string) commandLine {
+	cli := commandLine{
+		options: bock.Options{
+			GenerateRevisions: true,
+			Log:               os.Stdout,
+		},
+		port: DEFAULT_PORT,
+	}
+
+	// `defaults` is the site config's, so don't append to it
+	for _, arg := range append(append([]string{}, defaults...), args...) {
+		switch {
+		case strings.HasPrefix(arg, "--in="):
+			cli.options.ArticleRoot = arg[len("--in="):]
+
+		case strings.HasPrefix(arg, "--out="):
+			cli.options.OutputFolder = arg[len("--out="):]
+
+		case strings.HasPrefix(arg, "--revision="):
+			cli.revision = arg[len("--revision="):]
+
+		case strings.HasPrefix(arg, "--config="):
+			cli.configFile = arg[len("--config="):]
+
+		case strings.HasPrefix(arg, "--templates="):
+			cli.options.TemplateFolder = strings.TrimRight(arg[len("--templates="):], "/")
+
+		case strings.HasPrefix(arg, "--base-url="):
+			cli.options.BaseURL = strings.TrimRight(arg[len("--base-url="):], "/")
+
+		case strings.HasPrefix(arg, "--jobs="):
+			n, err := strconv.Atoi(arg[len("--jobs="):])
+			if err != nil || n < 1 {
+				fmt.Println("--jobs must be a number greater than zero")
+				os.Exit(EXIT_INVALID_FLAG_SUPPLIED)
+			}
+
+			cli.options.Jobs = n
+
+		case strings.HasPrefix(arg, "--port="):
+			n, err := strconv.Atoi(arg[len("--port="):])
+			if err != nil || n < 1 {
+				fmt.Println("--port must be a number greater than zero")
+				os.Exit(EXIT_INVALID_FLAG_SUPPLIED)
+			}
+
+			cli.port = n
+
+		case strings.HasPrefix(arg, "--search-index="):
+			kind := arg[len("--search-index="):]
+
+			switch kind {
+			case bock.SearchIndexSQLite, bock.SearchIndexJSON, bock.SearchIndexBoth:
+				cli.options.SearchIndex = kind
+			default:
+				fmt.Println("--search-index must be 'sqlite', 'json', or 'both'")
+				os.Exit(EXIT_INVALID_FLAG_SUPPLIED)
+			}
+
+		case arg == "--with-json-files":
+			cli.options.GenerateJSON = true
+
+		case arg == "--with-raw-markdown-files":
+			cli.options.GenerateRaw = true
+
+		case arg == "--without-revisions":
+			cli.options.GenerateRevisions = false
+
+		case arg == "--using-disk-fs":
+			cli.options.UseOnDiskFS = true
+
+		case arg == "--using-git-binary":
+			cli.options.UseGitBinary = true
+
+		case arg == "--keep-going":
+			cli.options.KeepGoing = true
+
+		case arg == "--fail-fast":
+			cli.options.KeepGoing = false
+
+		case arg == "--strict":
+			cli.options.Strict = true
+
+		case arg == "--json":
+			cli.json = true
+
+		case arg == "--rebuild-everything":
+			cli.options.RebuildEverything = true
+
+		case arg == "--version":
+			fmt.Println(bock.Version())
+			os.Exit(0)
+
+		case arg == "--help":
+			logo()
+			fmt.Println(help)
+			os.Exit(0)
+
+		default:
+			fmt.Println("I don't know what this means:", arg)
+			fmt.Println("Use --help to see usage.")
+			os.Exit(EXIT_INVALID_FLAG_SUPPLIED)
+		}
+	}
+
+	return cli
+}
@@ -1,47 +1,76 @@
-package main
+package bock
 
 import (
 	_ "embed"
 	"regexp"
 	"strings"
+	"time"
 )
 
 //go:embed VERSION
 var v []byte
-var VERSION string = strings.Trim(string(v), "\n")
+var version string = strings.Trim(string(v), "\n")
 
 // One of the strangest things I learned about Golang!
-const DATE_LAYOUT string = "2006-01-02 15:04:05 -0700"
+const dateLayout string = "2006-01-02 15:04:05 -0700"
 
 // The name of the SQLite database we will generate from the article repository
-const DATABASE_NAME string = "articles.db"
+const publicDatabaseName string = "articles.db"
+
+// What the database is called when only the JSON search index is published.
+// It's kept in the output (like the manifest) so the next build can update it.
+const privateDatabaseName string = ".bock-articles.db"
+
+// How the archive page searches: with `articles.db` and sql.js, with a
+// prebuilt index of JSON files in searchIndexFolder, or with either
+const SearchIndexSQLite string = "sqlite"
+const SearchIndexJSON string = "json"
+const SearchIndexBoth string = "both"
+const searchIndexFolder string = "search"
+
+// sql.js, which isn't copied over when only the JSON search index is used
+var sqlJSFiles = []string{"js/sql-wasm.js", "js/sql-wasm.wasm"}
+
+// Words in the JSON search index are put in files by their first few letters
+const searchIndexPrefixLength = 2
+
+// How many commits to show on the "Recent Changes" page and in the feeds
+const recentChangesCount = 50
+
+// How often `bock serve` looks for changes, and where pages listen for a
+// reload after a rebuild
+const watchInterval = time.Second
+const liveReloadPath = "/__bock/reload"
+
+// Where `bock serve` answers searches so pages don't need the whole database
+const searchAPIPath = "/api/search"
+
+// How wide the progress bar and the name of the thing being written next to it
+// can get on a terminal
+const progressBarWidth = 30
+const progressNameWidth = 40
+
+// How often we say how far along we are anywhere else (like CI logs): every so
+// many jobs or every so often, whichever comes first
+const progressLogJobs = 500
+const progressLogInterval = 5 * time.Second
+
+// What we look for in the article root if you don't use `--config`
+const SiteConfigName string = "bock.yaml"
+
+// What we write to the output folder to keep track of what we built
+const manifestName string = ".bock-manifest.json"
 
 // Where static assets (like images) are placed in the article repository
-const ARTICLE_REPOSITORY_ASSETS_FOLDER = "__assets"
-
-// Exit codes
-const (
-	EXIT_BAD_ARTICLE_ROOT int = iota + 10
-	EXIT_DATABASE_ERROR
-	EXIT_GENERAL_IO_ERROR
-	EXIT_NO_ARTICLE_ROOT
-	EXIT_NO_OUTPUT_FOLDER
-	EXIT_NOT_A_GIT_REPO
-	EXIT_NO_ARTICLES_TO_RENDER
-	EXIT_COULD_NOT_GENERATE_LIST_OF_ENTITIES
-	EXIT_COULD_NOT_WRITE_ENTITY_TREE
-	EXIT_COULD_NOT_CREATE_OUTPUT_FOLDER
-	EXIT_INVALID_FLAG_SUPPLIED
-)
+const assetsFolder = "__assets"
 
 // Things to ignore when walking the article repository. NOTE: In Golang, only
 // primitive types (like `int`, `string`, etc) can be constants. NOTE: Folders
 // beginning with `.` are automatically excluded in the function that uses this
 // pattern.
-var IGNORED_ENTITIES_REGEX = regexp.MustCompile(strings.Join([]string{
+var ignoredEntitiesRegex = regexp.MustCompile(strings.Join([]string{
 	"__assets",
 	"css",
-	"Home.md", // This is dealt with separately
 	"img",
 	"js",
 	"node_modules",
@@ -1,68 +1,508 @@
-package main
+package bock
 
 import (
 	"database/sql"
 	"fmt"
+	"io/fs"
 	"os"
+	"time"
 )
 
+// How times are stored. Drivers don't agree on what to do with a `time.Time`
+// so we turn them into strings ourselves. SQLite's date functions understand
+// these.
+const databaseTimeLayout = "2006-01-02 15:04:05.999999999-07:00"
+
+func databaseTime(t time.Time) string {
+	return t.UTC().Format(databaseTimeLayout)
+}
+
+// Bump this whenever the schema below (or what goes in it) changes. Databases
+// with a different version are recreated from scratch instead of being updated
+// in place.
+const schemaVersion = 7
+
+// NOTE: The full-text indexes use the `articles`, `revisions`, and `headings`
+// tables for their content so their rows have to be kept in sync with those
+// tables (by `rowid`) with triggers. Revisions never change so they're only
+// ever inserted or deleted (along with their article). Headings are replaced
+// whenever their article is written.
+//
+// Folders and articles are tied together by IDs, like `tree.json`, so the
+// whole wiki can be walked without it. Folders have no parent at the root.
 const setupStatement string = `
 CREATE TABLE IF NOT EXISTS articles (
   id              TEXT NOT NULL UNIQUE,
   content         TEXT,
   modified        TEXT NOT NULL,
   title           TEXT NOT NULL,
+  uri             TEXT NOT NULL,
+  description     TEXT,
+  tags            TEXT,
+  aliases         TEXT,
+  draft           INTEGER NOT NULL DEFAULT 0,
+  date            TEXT,
+  path            TEXT NOT NULL,
+  folder_id       TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS articles_folder_id ON articles (folder_id);
+
+CREATE TABLE IF NOT EXISTS folders (
+  id              TEXT NOT NULL UNIQUE,
+  parent_id       TEXT,
+  name            TEXT NOT NULL,
+  path            TEXT NOT NULL,
   uri             TEXT NOT NULL
 );
 
-CREATE VIRTUAL TABLE articles_fts USING fts5(
+CREATE INDEX IF NOT EXISTS folders_parent_id ON folders (parent_id);
+
+CREATE TABLE IF NOT EXISTS meta (
+  key             TEXT NOT NULL UNIQUE,
+  value
+);
+
+CREATE TABLE IF NOT EXISTS headings (
+  article_id      TEXT NOT NULL,
+  position        INTEGER NOT NULL,
+  level           INTEGER NOT NULL,
+  anchor          TEXT NOT NULL,
+  title           TEXT NOT NULL,
+  UNIQUE(article_id, position)
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS headings_fts USING fts5(
+  article_id UNINDEXED,
+  anchor UNINDEXED,
+  title,
+  content="headings"
+);
+
+CREATE TRIGGER IF NOT EXISTS headings_fts_insert AFTER INSERT ON headings
+  BEGIN
+    INSERT INTO headings_fts (
+      rowid,
+      article_id,
+      anchor,
+      title
+    )
+    VALUES (
+      new.rowid,
+      new.article_id,
+      new.anchor,
+      new.title
+    );
+END;
+
+CREATE TRIGGER IF NOT EXISTS headings_fts_delete AFTER DELETE ON headings
+  BEGIN
+    INSERT INTO headings_fts (
+      headings_fts,
+      rowid,
+      article_id,
+      anchor,
+      title
+    )
+    VALUES (
+      'delete',
+      old.rowid,
+      old.article_id,
+      old.anchor,
+      old.title
+    );
+END;
+
+CREATE TABLE IF NOT EXISTS tags (
+  article_id      TEXT NOT NULL,
+  tag             TEXT NOT NULL,
+  UNIQUE(article_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS tags_tag ON tags (tag);
+
+CREATE TABLE IF NOT EXISTS links (
+  source_id       TEXT NOT NULL,
+  target_id       TEXT NOT NULL,
+  UNIQUE(source_id, target_id)
+);
+
+CREATE INDEX IF NOT EXISTS links_target_id ON links (target_id);
+
+CREATE TABLE IF NOT EXISTS revisions (
+  id              TEXT NOT NULL,
+  short_id        TEXT NOT NULL,
+  article_id      TEXT NOT NULL,
+  path            TEXT NOT NULL,
+  content         TEXT,
+  subject         TEXT,
+  author          TEXT,
+  author_email    TEXT,
+  date            TEXT NOT NULL,
+  UNIQUE(article_id, id)
+);
+
+CREATE INDEX IF NOT EXISTS revisions_article_id ON revisions (article_id);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS revisions_fts USING fts5(
+  article_id UNINDEXED,
+  content,
+  subject,
+  author,
+  date UNINDEXED,
+  content="revisions"
+);
+
+CREATE TRIGGER IF NOT EXISTS revisions_fts_insert AFTER INSERT ON revisions
+  BEGIN
+    INSERT INTO revisions_fts (
+      rowid,
+      article_id,
+      content,
+      subject,
+      author,
+      date
+    )
+    VALUES (
+      new.rowid,
+      new.article_id,
+      new.content,
+      new.subject,
+      new.author,
+      new.date
+    );
+END;
+
+CREATE TRIGGER IF NOT EXISTS revisions_fts_delete AFTER DELETE ON revisions
+  BEGIN
+    INSERT INTO revisions_fts (
+      revisions_fts,
+      rowid,
+      article_id,
+      content,
+      subject,
+      author,
+      date
+    )
+    VALUES (
+      'delete',
+      old.rowid,
+      old.article_id,
+      old.content,
+      old.subject,
+      old.author,
+      old.date
+    );
+END;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS articles_fts USING fts5(
   id,
   content,
   modified,
   title,
   uri,
+  description,
+  tags,
   content="articles"
 );
 
-CREATE TRIGGER fts_update AFTER INSERT ON articles
+CREATE TRIGGER IF NOT EXISTS fts_insert AFTER INSERT ON articles
   BEGIN
     INSERT INTO articles_fts (
+      rowid,
       id,
       content,
       modified,
       title,
-      uri
+      uri,
+      description,
+      tags
     )
     VALUES (
+      new.rowid,
       new.id,
       new.content,
       new.modified,
       new.title,
-      new.uri
+      new.uri,
+      new.description,
+      new.tags
+    );
+END;
+
+CREATE TRIGGER IF NOT EXISTS fts_delete AFTER DELETE ON articles
+  BEGIN
+    INSERT INTO articles_fts (
+      articles_fts,
+      rowid,
+      id,
+      content,
+      modified,
+      title,
+      uri,
+      description,
+      tags
+    )
+    VALUES (
+      'delete',
+      old.rowid,
+      old.id,
+      old.content,
+      old.modified,
+      old.title,
+      old.uri,
+      old.description,
+      old.tags
     );
+    DELETE FROM tags WHERE article_id = old.id;
+    DELETE FROM links WHERE source_id = old.id;
+    DELETE FROM revisions WHERE article_id = old.id;
+    DELETE FROM headings WHERE article_id = old.id;
 END;
+
+CREATE TRIGGER IF NOT EXISTS fts_update AFTER UPDATE ON articles
+  BEGIN
+    INSERT INTO articles_fts (
+      articles_fts,
+      rowid,
+      id,
+      content,
+      modified,
+      title,
+      uri,
+      description,
+      tags
+    )
+    VALUES (
+      'delete',
+      old.rowid,
+      old.id,
+      old.content,
+      old.modified,
+      old.title,
+      old.uri,
+      old.description,
+      old.tags
+    );
+    INSERT INTO articles_fts (
+      rowid,
+      id,
+      content,
+      modified,
+      title,
+      uri,
+      description,
+      tags
+    )
+    VALUES (
+      new.rowid,
+      new.id,
+      new.content,
+      new.modified,
+      new.title,
+      new.uri,
+      new.description,
+      new.tags
+    );
+END;
+`
+
+// Inserts an article or updates it if it's already there. Updating (instead of
+// replacing) makes sure the triggers above keep the full-text index in sync.
+const upsertArticleStatement string = `
+INSERT INTO articles (
+  id,
+  content,
+  modified,
+  title,
+  uri,
+  description,
+  tags,
+  aliases,
+  draft,
+  date,
+  path,
+  folder_id
+)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (id) DO UPDATE SET
+  content = excluded.content,
+  modified = excluded.modified,
+  title = excluded.title,
+  uri = excluded.uri,
+  description = excluded.description,
+  tags = excluded.tags,
+  aliases = excluded.aliases,
+  draft = excluded.draft,
+  date = excluded.date,
+  path = excluded.path,
+  folder_id = excluded.folder_id
+`
+
+// Adds a revision of an article unless it's already there
+const insertRevisionStatement string = `
+INSERT INTO revisions (
+  id,
+  short_id,
+  article_id,
+  path,
+  content,
+  subject,
+  author,
+  author_email,
+  date
+)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (article_id, id) DO NOTHING
+`
+
+// An article's headings are replaced every time it's written
+const deleteHeadingsStatement string = `
+DELETE FROM headings WHERE article_id = ?
+`
+
+const insertHeadingStatement string = `
+INSERT INTO headings (
+  article_id,
+  position,
+  level,
+  anchor,
+  title
+)
+VALUES (?, ?, ?, ?, ?)
 `
 
-// Set up the database and schema. Assumed that the output folder exists.
-func makeDatabase(config *BockConfig) *sql.DB {
-	dbPath := config.outputFolder + "/" + DATABASE_NAME
+// Describe the build: everything in `meta` (with the same names it has in
+// JSON) along with the versions of bock and of the schema. Call this once
+// everything else is done so the counts and times are right.
+func writeDatabaseMeta(config *bockConfig) error {
+	meta := config.meta
 
-	fmt.Println("Creating database", dbPath)
+	rows := []struct {
+		key   string
+		value interface{}
+	}{
+		{"version", version},
+		{"schemaVersion", schemaVersion},
+		{"architecture", meta.Architecture},
+		{"articleCount", meta.ArticleCount},
+		{"buildTime", databaseTime(meta.BuildDate)},
+		{"cpuCount", meta.CPUCount},
+		{"folderCount", meta.FolderCount},
+		{"generateJSON", meta.GenerateJSON},
+		{"generateRaw", meta.GenerateRaw},
+		{"generateRevisions", meta.GenerateRevisions},
+		{"generationTime", int64(meta.GenerationTime)},
+		{"generationTimeRounded", int64(meta.GenerationTimeRounded)},
+		{"memoryInGB", meta.MemoryInGB},
+		{"platform", meta.Platform},
+		{"revisionCount", meta.RevisionCount},
+		{"searchIndex", meta.SearchIndex},
+		{"tagCount", meta.TagCount},
+	}
+
+	tx, err := config.database.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM meta`); err != nil {
+		return fmt.Errorf("could not clear meta: %w", err)
+	}
+
+	for _, r := range rows {
+		if _, err := tx.Exec(`INSERT INTO meta (key, value) VALUES (?, ?)`, r.key, r.value); err != nil {
+			return fmt.Errorf("could not set '%s': %w", r.key, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SQLite needs a file on disk. That's the one in the output folder if there is
+// one. Otherwise we build the database in a temporary file, starting with the
+// one from the previous build if the output has it, and copy it to the output
+// once it's done.
+func makeDatabaseFile(config *bockConfig, rebuild bool) (string, error) {
+	if folder, ok := config.output.(*DirOutput); ok {
+		return folder.path(databaseName(config.meta.SearchIndex)), os.MkdirAll(folder.folder, os.ModePerm)
+	}
+
+	f, err := os.CreateTemp("", "bock-*.db")
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+	config.databaseFile = f.Name()
+
+	if previous, err := fs.ReadFile(config.output, databaseName(config.meta.SearchIndex)); err == nil && !rebuild {
+		if _, err := f.Write(previous); err != nil {
+			return "", err
+		}
+	}
 
-	// Recreate the database from scratch. TODO: Do this intelligently.
-	os.Remove(dbPath)
+	return f.Name(), nil
+}
 
-	db, err := sql.Open("sqlite3", dbPath)
+// Copy a database built in a temporary file to the output
+func saveDatabase(config *bockConfig) error {
+	contents, err := os.ReadFile(config.databaseFile)
 	if err != nil {
-		fmt.Println("ERROR: Could not open", dbPath, ":", err)
-		os.Exit(EXIT_DATABASE_ERROR)
+		return err
+	}
+
+	return writeFile("/"+databaseName(config.meta.SearchIndex), contents, config)
+}
+
+// Set up the database and schema. The database from a previous build is
+// updated in place unless we're rebuilding everything or its schema is out of
+// date. Returns whether the database was created from scratch.
+func makeDatabase(config *bockConfig, rebuild bool) (*sql.DB, bool, error) {
+	dbPath, err := makeDatabaseFile(config, rebuild)
+	if err != nil {
+		return nil, true, fmt.Errorf("could not make %s: %w", databaseName(config.meta.SearchIndex), err)
+	}
+
+	if !rebuild {
+		if db, err := sql.Open(sqliteDriver, dbPath); err == nil {
+			var version int
+			db.QueryRow("PRAGMA user_version").Scan(&version)
+			db.Close()
+
+			rebuild = version != schemaVersion
+		}
+	}
+
+	// Temporary files aren't worth mentioning
+	name := dbPath
+	if config.databaseFile != "" {
+		name = databaseName(config.meta.SearchIndex)
+	}
+
+	if rebuild {
+		fmt.Fprintln(config.log, "Creating database", name)
+		os.Remove(dbPath)
+	} else {
+		fmt.Fprintln(config.log, "Updating database", name)
 	}
 
-	_, err = db.Exec(setupStatement)
+	db, err := sql.Open(sqliteDriver, dbPath)
 	if err != nil {
-		fmt.Printf("ERROR: Could not set up database: %q\n", err)
-		os.Exit(EXIT_DATABASE_ERROR)
+		return nil, rebuild, fmt.Errorf("could not open %s: %w", dbPath, err)
+	}
+
+	if _, err = db.Exec(setupStatement); err != nil {
+		db.Close()
+		return nil, rebuild, fmt.Errorf("could not set up %s: %w", dbPath, err)
+	}
+
+	if _, err = db.Exec(fmt.Sprintf("PRAGMA user_version = %d", schemaVersion)); err != nil {
+		db.Close()
+		return nil, rebuild, fmt.Errorf("could not set up %s: %w", dbPath, err)
 	}
 
-	return db
+	return db, rebuild, nil
 }
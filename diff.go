@@ -0,0 +1,195 @@
+package bock
+
+import (
+	"strings"
+)
+
+// Diffs are made here for the generated diff pages and in `compare.js` for
+// comparing any two revisions in the browser. Both use the same algorithm (so
+// keep them in sync!) and show the same thing for the same revisions:
+//
+//  1. Lines that are the same at the start and end are skipped over
+//  2. What's left between them is diffed with Myers' algorithm, which is what
+//     `git diff` uses too
+//
+// Myers' algorithm needs time and memory that grow with the square of the
+// number of lines that changed. Past diffMaxEdits of them, what's left is
+// shown as deleted and then inserted wholesale.
+const diffMaxEdits = 1000
+
+type diffLine struct {
+	// One of "insert", "delete", or "equal"
+	Type string `json:"type"`
+	Text string `json:"text"`
+
+	// Line numbers in the older and newer revisions. Zero if the line does not
+	// exist in that revision (e.g. it was inserted or deleted).
+	Old int `json:"old"`
+	New int `json:"new"`
+}
+
+type diff struct {
+	Deletions  int        `json:"deletions"`
+	Insertions int        `json:"insertions"`
+	Lines      []diffLine `json:"lines"`
+}
+
+// A file's lines. A newline at the very end doesn't start another one.
+func linesOf(text string) []string {
+	lines := strings.Split(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// Make a line-level diff between two revisions of an article. This is pretty
+// much what `git diff` would show you, minus the hunks: you get every line.
+func makeDiff(older string, newer string) diff {
+	a, b := linesOf(older), linesOf(newer)
+
+	start := 0
+	for start < len(a) && start < len(b) && a[start] == b[start] {
+		start++
+	}
+
+	aEnd, bEnd := len(a), len(b)
+	for aEnd > start && bEnd > start && a[aEnd-1] == b[bEnd-1] {
+		aEnd--
+		bEnd--
+	}
+
+	diff := diff{Lines: []diffLine{}}
+
+	for i := 0; i < start; i++ {
+		diff.Lines = append(diff.Lines, diffLine{Type: "equal", Text: a[i], Old: i + 1, New: i + 1})
+	}
+
+	for _, line := range diffMiddle(a, b, start, aEnd, bEnd) {
+		switch line.Type {
+		case "insert":
+			diff.Insertions += 1
+		case "delete":
+			diff.Deletions += 1
+		}
+
+		diff.Lines = append(diff.Lines, line)
+	}
+
+	for i, j := aEnd, bEnd; i < len(a); i, j = i+1, j+1 {
+		diff.Lines = append(diff.Lines, diffLine{Type: "equal", Text: a[i], Old: i + 1, New: j + 1})
+	}
+
+	return diff
+}
+
+// Diff a[start:aEnd] against b[start:bEnd]. Line numbers carry on from
+// `start`.
+func diffMiddle(a []string, b []string, start int, aEnd int, bEnd int) []diffLine {
+	n, m := aEnd-start, bEnd-start
+	lines := []diffLine{}
+
+	deleted := func(x int) diffLine {
+		return diffLine{Type: "delete", Text: a[start+x], Old: start + x + 1}
+	}
+
+	inserted := func(y int) diffLine {
+		return diffLine{Type: "insert", Text: b[start+y], New: start + y + 1}
+	}
+
+	equal := func(x int, y int) diffLine {
+		return diffLine{Type: "equal", Text: a[start+x], Old: start + x + 1, New: start + y + 1}
+	}
+
+	// How far along `a` the furthest path with `d` edits gets on each diagonal
+	// `k` (where k = x - y). `trace[d]` is that for diagonals -d to d.
+	furthest := make([]int, 2*(n+m)+3)
+	offset := n + m + 1
+	trace := [][]int{}
+	edits := -1
+
+	for d := 0; d <= n+m && edits < 0; d++ {
+		if d > diffMaxEdits {
+			for x := 0; x < n; x++ {
+				lines = append(lines, deleted(x))
+			}
+
+			for y := 0; y < m; y++ {
+				lines = append(lines, inserted(y))
+			}
+
+			return lines
+		}
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && furthest[offset+k-1] < furthest[offset+k+1]) {
+				x = furthest[offset+k+1]
+			} else {
+				x = furthest[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[start+x] == b[start+y] {
+				x++
+				y++
+			}
+
+			furthest[offset+k] = x
+
+			if x >= n && y >= m {
+				edits = d
+				break
+			}
+		}
+
+		trace = append(trace, append([]int{}, furthest[offset-d:offset+d+1]...))
+	}
+
+	// Walk back from the end to find which edits got us there
+	reversed := []diffLine{}
+	x, y := n, m
+
+	for d := edits; d > 0; d-- {
+		previous := trace[d-1]
+		at := func(k int) int { return previous[k+d-1] }
+
+		k := x - y
+		var previousK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			previousK = k + 1
+		} else {
+			previousK = k - 1
+		}
+
+		previousX := at(previousK)
+		previousY := previousX - previousK
+
+		for x > previousX && y > previousY {
+			x--
+			y--
+			reversed = append(reversed, equal(x, y))
+		}
+
+		if previousK == k+1 {
+			reversed = append(reversed, inserted(previousY))
+		} else {
+			reversed = append(reversed, deleted(previousX))
+		}
+
+		x, y = previousX, previousY
+	}
+
+	for x > 0 && y > 0 {
+		x--
+		y--
+		reversed = append(reversed, equal(x, y))
+	}
+
+	for i := len(reversed) - 1; i >= 0; i-- {
+		lines = append(lines, reversed[i])
+	}
+
+	return lines
+}
@@ -0,0 +1,151 @@
+package bock
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// A compact way to write diffs: " a" is an equal line, "-a" a deleted one, and
+// "+a" an inserted one
+func summarizeDiff(diff diff) []string {
+	marks := map[string]string{"equal": " ", "delete": "-", "insert": "+"}
+	summary := []string{}
+
+	for _, l := range diff.Lines {
+		summary = append(summary, marks[l.Type]+l.Text)
+	}
+
+	return summary
+}
+
+func TestMakeDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		older  string
+		newer  string
+		want   []string
+		counts [2]int
+	}{
+		{"the same", "a\nb\n", "a\nb\n", []string{" a", " b"}, [2]int{0, 0}},
+		{"both empty", "", "", []string{}, [2]int{0, 0}},
+		{"the first revision", "", "a\nb\n", []string{"+a", "+b"}, [2]int{2, 0}},
+		{"deleted everything", "a\nb\n", "", []string{"-a", "-b"}, [2]int{0, 2}},
+		{"a changed line", "a\nb\nc\n", "a\nB\nc\n", []string{" a", "-b", "+B", " c"}, [2]int{1, 1}},
+		{"no newline at the end", "a\nb", "a\nb\n", []string{" a", " b"}, [2]int{0, 0}},
+		{"moved", "a\nb\nc\nd\n", "b\nc\nd\na\n", []string{"-a", " b", " c", " d", "+a"}, [2]int{1, 1}},
+		{"blank lines", "a\n\nb\n", "a\n\n\nb\n", []string{" a", " ", "+", " b"}, [2]int{1, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := makeDiff(tt.older, tt.newer)
+
+			if got := summarizeDiff(diff); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+
+			if diff.Insertions != tt.counts[0] || diff.Deletions != tt.counts[1] {
+				t.Errorf("got +%d -%d, want +%d -%d", diff.Insertions, diff.Deletions, tt.counts[0], tt.counts[1])
+			}
+		})
+	}
+}
+
+// The length of the longest common subsequence of two lists of lines
+func lengthOfLCS(a []string, b []string) int {
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	return lengths[0][0]
+}
+
+// Any two revisions give back both revisions, with the right line numbers and
+// as few changes as possible
+func TestMakeDiffProperties(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	randomLines := func() []string {
+		lines := make([]string, random.Intn(15))
+		for i := range lines {
+			lines[i] = string(rune('a' + random.Intn(4)))
+		}
+
+		return lines
+	}
+
+	for i := 0; i < 1000; i++ {
+		a, b := randomLines(), randomLines()
+		diff := makeDiff(strings.Join(a, "\n"), strings.Join(b, "\n"))
+
+		older, newer, equal := []string{}, []string{}, 0
+
+		for _, l := range diff.Lines {
+			if l.Type != "insert" {
+				older = append(older, l.Text)
+				if l.Old != len(older) {
+					t.Fatalf("%q -> %q: %+v is line %d of the older revision", a, b, l, len(older))
+				}
+			}
+
+			if l.Type != "delete" {
+				newer = append(newer, l.Text)
+				if l.New != len(newer) {
+					t.Fatalf("%q -> %q: %+v is line %d of the newer revision", a, b, l, len(newer))
+				}
+			}
+
+			if l.Type == "equal" {
+				equal++
+			}
+		}
+
+		if strings.Join(older, "|") != strings.Join(a, "|") || strings.Join(newer, "|") != strings.Join(b, "|") {
+			t.Fatalf("%q -> %q: got %q", a, b, summarizeDiff(diff))
+		}
+
+		if want := lengthOfLCS(a, b); equal != want {
+			t.Fatalf("%q -> %q: %d lines are the same, want %d", a, b, equal, want)
+		}
+	}
+}
+
+func TestMakeDiffWithTooManyEdits(t *testing.T) {
+	older, newer := []string{"first"}, []string{"first"}
+	for i := 0; i < diffMaxEdits; i++ {
+		older = append(older, "old", "same")
+		newer = append(newer, "new", "same")
+	}
+
+	older, newer = append(older, "last"), append(newer, "last")
+	diff := makeDiff(strings.Join(older, "\n"), strings.Join(newer, "\n"))
+
+	summary := summarizeDiff(diff)
+
+	// Everything but "first", the last "same", and "last"
+	lines := len(older) - 3
+
+	if summary[0] != " first" || summary[len(summary)-1] != " last" {
+		t.Errorf("the lines that are the same at either end aren't: %q, %q", summary[0], summary[len(summary)-1])
+	}
+
+	if diff.Deletions != lines || diff.Insertions != lines {
+		t.Errorf("got +%d -%d, want everything in between replaced (+%d -%d)", diff.Insertions, diff.Deletions, lines, lines)
+	}
+
+	if summary[1] != "-old" || summary[lines] != "-old" || summary[lines+1] != "+new" {
+		t.Errorf("what's in between isn't deleted and then inserted")
+	}
+}
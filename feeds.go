@@ -0,0 +1,164 @@
+package bock
+
+import (
+	"encoding/xml"
+	"html"
+	"time"
+)
+
+// Atom and RSS feeds of recent changes to the wiki. Both are built from the
+// same list of changes as the "Recent Changes" page. Feed readers prefer
+// absolute URLs so use `--base-url` if you can.
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Links   []atomLink `xml:"link"`
+	Author  atomAuthor `xml:"author"`
+	Summary atomText   `xml:"summary"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	Author      string  `xml:"author,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+// Where a feed entry should take you: what changed in the first article the
+// commit touched.
+func makeChangeURI(change change) string {
+	if len(change.Articles) == 0 {
+		return "/recent"
+	}
+
+	return change.Articles[0].URI + "/revisions/" + change.ShortId + "/diff"
+}
+
+// A small HTML list of the articles that a change touched
+func makeChangeSummary(change change, config *bockConfig) string {
+	summary := "<ul>"
+
+	for _, a := range change.Articles {
+		summary += `<li><a href="` + config.baseURL + a.URI + `">` + html.EscapeString(a.Name) + "</a></li>"
+	}
+
+	return summary + "</ul>"
+}
+
+func renderAtomFeed(changes []change, config *bockConfig) ([]byte, error) {
+	updated := config.meta.BuildDate
+	if len(changes) > 0 {
+		updated = changes[0].Date
+	}
+
+	feed := atomFeed{
+		ID:      "urn:uuid:" + makeID(config.baseURL+"/recent"),
+		Title:   "Recent Changes",
+		Updated: updated.Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: config.baseURL + "/feed.atom", Rel: "self", Type: "application/atom+xml"},
+			{Href: config.baseURL + "/recent", Rel: "alternate", Type: "text/html"},
+		},
+		Entries: []atomEntry{},
+	}
+
+	for _, c := range changes {
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      "urn:uuid:" + makeID(c.Id),
+			Title:   c.Subject,
+			Updated: c.Date.Format(time.RFC3339),
+			Links: []atomLink{
+				{Href: config.baseURL + makeChangeURI(c), Rel: "alternate", Type: "text/html"},
+			},
+			Author: atomAuthor{
+				Name:  c.AuthorName,
+				Email: c.AuthorEmail,
+			},
+			Summary: atomText{
+				Type: "html",
+				Body: makeChangeSummary(c, config),
+			},
+		})
+	}
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	return append([]byte(xml.Header), out...), err
+}
+
+func renderRSSFeed(changes []change, config *bockConfig) ([]byte, error) {
+	feed := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         "Recent Changes",
+			Link:          config.baseURL + "/recent",
+			Description:   "The latest changes to articles in this wiki",
+			LastBuildDate: config.meta.BuildDate.Format(time.RFC1123Z),
+			Items:         []rssItem{},
+		},
+	}
+
+	for _, c := range changes {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       c.Subject,
+			Link:        config.baseURL + makeChangeURI(c),
+			Description: makeChangeSummary(c, config),
+			Author:      c.AuthorEmail + " (" + c.AuthorName + ")",
+			GUID: rssGUID{
+				IsPermaLink: "false",
+				Value:       c.Id,
+			},
+			PubDate: c.Date.Format(time.RFC1123Z),
+		})
+	}
+
+	out, err := xml.MarshalIndent(feed, "", "  ")
+	return append([]byte(xml.Header), out...), err
+}
@@ -0,0 +1,192 @@
+package bock
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Articles are read from an `fs.FS` rooted at the article root. That's the
+// folder on disk unless you give us something else, like a git tree. Paths
+// everywhere else still start with the article root (it's how URIs and IDs are
+// made) so this turns them into names in that `fs.FS`.
+func articleFileName(p string, config *bockConfig) string {
+	if name := makeRelativePath(p, config.articleRoot); name != "" {
+		return name
+	}
+
+	return "."
+}
+
+func readArticleFile(p string, config *bockConfig) ([]byte, error) {
+	return fs.ReadFile(config.articles, articleFileName(p, config))
+}
+
+// The files in a git repository as of a commit, branch, or tag. Nothing is
+// checked out so this works with bare repositories too. Everything was last
+// modified when that commit was made.
+func GitTreeFS(repositoryPath string, revision string) (fs.FS, error) {
+	repository, err := git.PlainOpen(repositoryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	hash, err := repository.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := repository.CommitObject(*hash)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	return &gitTreeFS{tree: tree, modified: commit.Committer.When}, nil
+}
+
+type gitTreeFS struct {
+	// `go-git` objects aren't safe to read from several goroutines at once
+	mutex    sync.Mutex
+	tree     *object.Tree
+	modified time.Time
+}
+
+func (t *gitTreeFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if name == "." {
+		return t.openFolder(name, t.tree)
+	}
+
+	entry, err := t.tree.FindEntry(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if entry.Mode == filemode.Dir {
+		subtree, err := t.tree.Tree(name)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+
+		return t.openFolder(name, subtree)
+	}
+
+	file, err := t.tree.TreeEntryFile(entry)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	contents, err := file.Contents()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &gitTreeFile{
+		Reader: bytes.NewReader([]byte(contents)),
+		info:   gitTreeInfo{name: path.Base(name), size: file.Size, modified: t.modified},
+	}, nil
+}
+
+func (t *gitTreeFS) openFolder(name string, tree *object.Tree) (fs.File, error) {
+	entries := []fs.DirEntry{}
+
+	for _, e := range tree.Entries {
+		info := gitTreeInfo{name: e.Name, modified: t.modified, folder: e.Mode == filemode.Dir}
+
+		if !info.folder {
+			e := e
+			if file, err := tree.TreeEntryFile(&e); err == nil {
+				info.size = file.Size
+			}
+		}
+
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return &gitTreeFolder{
+		info:    gitTreeInfo{name: path.Base(name), modified: t.modified, folder: true},
+		entries: entries,
+	}, nil
+}
+
+type gitTreeInfo struct {
+	name     string
+	size     int64
+	modified time.Time
+	folder   bool
+}
+
+func (i gitTreeInfo) Name() string       { return i.name }
+func (i gitTreeInfo) Size() int64        { return i.size }
+func (i gitTreeInfo) ModTime() time.Time { return i.modified }
+func (i gitTreeInfo) IsDir() bool        { return i.folder }
+func (i gitTreeInfo) Sys() interface{}   { return nil }
+
+func (i gitTreeInfo) Mode() fs.FileMode {
+	if i.folder {
+		return fs.ModeDir | 0o755
+	}
+
+	return 0o644
+}
+
+type gitTreeFile struct {
+	*bytes.Reader
+	info gitTreeInfo
+}
+
+func (f *gitTreeFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *gitTreeFile) Close() error               { return nil }
+
+type gitTreeFolder struct {
+	info    gitTreeInfo
+	entries []fs.DirEntry
+	read    int
+}
+
+func (f *gitTreeFolder) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *gitTreeFolder) Close() error               { return nil }
+
+func (f *gitTreeFolder) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.info.name, Err: fs.ErrInvalid}
+}
+
+func (f *gitTreeFolder) ReadDir(count int) ([]fs.DirEntry, error) {
+	rest := f.entries[f.read:]
+
+	if count > 0 {
+		if len(rest) == 0 {
+			return nil, io.EOF
+		}
+
+		if count < len(rest) {
+			rest = rest[:count]
+		}
+	}
+
+	f.read += len(rest)
+
+	return rest, nil
+}
@@ -0,0 +1,92 @@
+package bock
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Frontmatter is an optional block at the very top of an article. YAML blocks
+// are fenced with `---` and TOML blocks with `+++`. For example,
+//
+//	---
+//	title: pf Notes
+//	description: Things I keep forgetting about OpenBSD's packet filter
+//	tags: [openbsd, networking]
+//	aliases: [Packet Filter]
+//	draft: false
+//	date: 2021-04-01
+//	toc: 2
+//	---
+//
+// The opening fence must be the very first line of the file and there must be
+// a closing fence. Anything else is treated as regular Markdown.
+const (
+	yamlFrontmatterFence = "---"
+	tomlFrontmatterFence = "+++"
+)
+
+var newline = []byte("\n")
+
+// Split an article's source into its frontmatter and its Markdown body. If
+// there's no frontmatter, the source is returned untouched. If there is and
+// it can't be parsed, the body is still returned (stripped of the block) along
+// with the error so that callers can warn and carry on.
+func parseFrontmatter(source []byte) (frontmatter, []byte, error) {
+	parsed := frontmatter{}
+
+	block, body, fence := splitFrontmatter(source)
+	if fence == "" {
+		return parsed, source, nil
+	}
+
+	var err error
+	if fence == yamlFrontmatterFence {
+		err = yaml.Unmarshal(block, &parsed)
+	} else {
+		_, err = toml.Decode(string(block), &parsed)
+	}
+
+	if err != nil {
+		return frontmatter{}, body, errors.New("could not parse frontmatter: " + err.Error())
+	}
+
+	return parsed, body, nil
+}
+
+// Find the frontmatter block (without its fences) and the rest of the article.
+// Returns the fence that was used or an empty string if there's no block.
+func splitFrontmatter(source []byte) (block []byte, body []byte, fence string) {
+	source = bytes.TrimPrefix(source, []byte("\xef\xbb\xbf")) // BOMs are a thing
+
+	firstLine, rest, found := bytes.Cut(source, newline)
+	if !found {
+		return nil, source, ""
+	}
+
+	fence = string(bytes.TrimRight(firstLine, " \t\r"))
+	if fence != yamlFrontmatterFence && fence != tomlFrontmatterFence {
+		return nil, source, ""
+	}
+
+	// Look for the closing fence, line by line
+	offset := 0
+	for offset <= len(rest) {
+		line, remaining, more := bytes.Cut(rest[offset:], newline)
+
+		if string(bytes.TrimRight(line, " \t\r")) == fence {
+			return rest[:offset], remaining, fence
+		}
+
+		if !more {
+			break
+		}
+
+		offset += len(line) + 1
+	}
+
+	// An opening fence without a closing one is probably a horizontal rule.
+	return nil, source, ""
+}
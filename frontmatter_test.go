@@ -0,0 +1,99 @@
+package bock
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFrontmatter(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		title   string
+		tags    []string
+		body    string
+		wantErr bool
+	}{
+		{
+			name:   "none",
+			source: "# pf\n\nNotes\n",
+			body:   "# pf\n\nNotes\n",
+		},
+		{
+			name:   "YAML",
+			source: "---\ntitle: pf Notes\ntags: [openbsd, networking]\n---\n# pf\n",
+			title:  "pf Notes",
+			tags:   []string{"openbsd", "networking"},
+			body:   "# pf\n",
+		},
+		{
+			name:   "TOML",
+			source: "+++\ntitle = \"pf Notes\"\ntags = [\"openbsd\"]\n+++\n# pf\n",
+			title:  "pf Notes",
+			tags:   []string{"openbsd"},
+			body:   "# pf\n",
+		},
+		{
+			name:   "Windows line endings and a BOM",
+			source: "\xef\xbb\xbf---\r\ntitle: pf Notes\r\n---\r\n# pf\r\n",
+			title:  "pf Notes",
+			body:   "# pf\r\n",
+		},
+		{
+			name:   "empty",
+			source: "---\n---\n# pf\n",
+			body:   "# pf\n",
+		},
+		{
+			name:   "at the very end",
+			source: "---\ntitle: pf Notes\n---",
+			title:  "pf Notes",
+			body:   "",
+		},
+		{
+			name:   "unterminated",
+			source: "---\ntitle: pf Notes\n\n# pf\n",
+			body:   "---\ntitle: pf Notes\n\n# pf\n",
+		},
+		{
+			name:   "a horizontal rule that isn't first",
+			source: "# pf\n---\ntitle: pf Notes\n---\n",
+			body:   "# pf\n---\ntitle: pf Notes\n---\n",
+		},
+		{
+			name:   "mismatched fences",
+			source: "---\ntitle: pf Notes\n+++\n# pf\n",
+			body:   "---\ntitle: pf Notes\n+++\n# pf\n",
+		},
+		{
+			name:    "invalid",
+			source:  "---\ntags: [openbsd\n---\n# pf\n",
+			body:    "# pf\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frontmatter, body, err := parseFrontmatter([]byte(tt.source))
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want one: %v", err, tt.wantErr)
+			}
+
+			if frontmatter.Title != tt.title {
+				t.Errorf("got title %q, want %q", frontmatter.Title, tt.title)
+			}
+
+			if len(frontmatter.Tags) > 0 || len(tt.tags) > 0 {
+				if !reflect.DeepEqual(frontmatter.Tags, tt.tags) {
+					t.Errorf("got tags %q, want %q", frontmatter.Tags, tt.tags)
+				}
+			}
+
+			if string(body) != tt.body {
+				t.Errorf("got body %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package bock
+
+import (
+	"errors"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// Everything we need to know about the article repository's history. There
+// are two of these: one that uses `go-git` (the default) and one that shells
+// out to whatever `git` is installed on the system. The latter is a LOT
+// faster with large repositories.
+//
+// All paths are relative to the article root.
+type gitBackend interface {
+	// Whether the working tree has uncommitted changes.
+	IsClean() bool
+
+	// Whether the given path has never been committed.
+	IsUntracked(relativePath string) bool
+
+	// Every revision of an article, newest first. Revision contents are not
+	// loaded. Use `Content` for that.
+	History(relativePath string) ([]revision, error)
+
+	// The contents of an article as of the given revision.
+	Content(revision revision) (string, error)
+
+	// The latest `count` commits that changed articles `wanted` says to keep,
+	// newest first. Only those articles are in the changes' paths.
+	RecentChanges(count int, wanted func(relativePath string) bool) ([]change, error)
+}
+
+type goGitBackend struct {
+	repository *git.Repository
+	status     git.Status
+	index      map[string][]revision
+	changes    []change
+}
+
+// Open the article repository with `go-git` and index its history. The
+// repository is cloned into memory unless `useOnDiskFS` is set.
+func newGoGitBackend(articleRoot string, useOnDiskFS bool) (*goGitBackend, error) {
+	var repository *git.Repository
+	var err error
+
+	if useOnDiskFS {
+		repository, err = git.PlainOpen(articleRoot)
+	} else {
+		repository, err = git.Clone(
+			memory.NewStorage(),
+			memfs.New(),
+			&git.CloneOptions{
+				URL: articleRoot,
+			},
+		)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the working tree's status. Note that this is useless when the
+	// repository has been cloned into memory: a fresh clone is always clean.
+	workingTree, err := repository.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := workingTree.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	index, changes, err := makeHistoryIndex(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	return &goGitBackend{
+		repository: repository,
+		status:     status,
+		index:      index,
+		changes:    changes,
+	}, nil
+}
+
+func (b *goGitBackend) IsClean() bool {
+	return b.status.IsClean()
+}
+
+func (b *goGitBackend) IsUntracked(relativePath string) bool {
+	return b.status.IsUntracked(relativePath)
+}
+
+func (b *goGitBackend) History(relativePath string) ([]revision, error) {
+	revisions, ok := b.index[relativePath]
+	if !ok {
+		return nil, errors.New("no history for " + relativePath)
+	}
+
+	return revisions, nil
+}
+
+func (b *goGitBackend) Content(revision revision) (string, error) {
+	blob, err := b.repository.BlobObject(revision.blobHash)
+	if err != nil {
+		return "", err
+	}
+
+	return object.NewFile(revision.Path, 0, blob).Contents()
+}
+
+func (b *goGitBackend) RecentChanges(count int, wanted func(relativePath string) bool) ([]change, error) {
+	changes := []change{}
+
+	for _, c := range b.changes {
+		if len(changes) == count {
+			break
+		}
+
+		if c, ok := keepWantedPaths(c, wanted); ok {
+			changes = append(changes, c)
+		}
+	}
+
+	return changes, nil
+}
+
+// The change with only the paths that are wanted, and whether there are any
+func keepWantedPaths(change change, wanted func(relativePath string) bool) (change, bool) {
+	paths := []string{}
+
+	for _, p := range change.paths {
+		if wanted(p) {
+			paths = append(paths, p)
+		}
+	}
+
+	change.paths = paths
+
+	return change, len(paths) > 0
+}
@@ -0,0 +1,287 @@
+package bock
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Separators for the fields and records we ask `git log` for. These are the
+// ASCII unit and record separators and should never show up in a commit.
+const (
+	gitFieldSeparator  = "\x1f"
+	gitRecordSeparator = "\x1e"
+)
+
+// `git log` format for revisions: hash, author name, author email, strict ISO
+// author date, and the raw commit message.
+const gitLogFormat = "%x1e%H%x1f%an%x1f%ae%x1f%aI%x1f%B%x1f"
+
+// A backend that shells out to the system's `git`. This needs the article root
+// to be an actual working tree on disk. It doesn't have to be the top of the
+// repository, but `git` gives us paths relative to that.
+type gitCLIBackend struct {
+	articleRoot string
+	untracked   map[string]bool
+	clean       bool
+
+	// Where the article root is in the repository, like "wiki/", if anywhere
+	prefix string
+}
+
+func newGitCLIBackend(articleRoot string) (*gitCLIBackend, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, errors.New("could not find a 'git' executable")
+	}
+
+	b := &gitCLIBackend{
+		articleRoot: articleRoot,
+		untracked:   make(map[string]bool),
+		clean:       true,
+	}
+
+	if _, err := b.git("rev-parse", "--is-inside-work-tree"); err != nil {
+		return nil, err
+	}
+
+	prefix, err := b.git("rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+
+	b.prefix = strings.TrimSpace(prefix)
+
+	// Entries look like "XY path" and are NUL-terminated. Renames and copies
+	// are followed by an extra entry with the original path. Only what's under
+	// the article root counts.
+	status, err := b.git("status", "--porcelain=v1", "-z", "--untracked-files=all", "--", ".")
+	if err != nil {
+		return nil, err
+	}
+
+	entries := strings.Split(status, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+
+		b.clean = false
+		code, path := entry[0:2], b.relative(entry[3:])
+
+		if code == "??" {
+			b.untracked[path] = true
+		}
+
+		if code[0] == 'R' || code[0] == 'C' {
+			i += 1
+		}
+	}
+
+	return b, nil
+}
+
+func (b *gitCLIBackend) IsClean() bool {
+	return b.clean
+}
+
+func (b *gitCLIBackend) IsUntracked(relativePath string) bool {
+	return b.untracked[relativePath]
+}
+
+func (b *gitCLIBackend) History(relativePath string) ([]revision, error) {
+	out, err := b.git(
+		"log",
+		"--follow",
+		"--name-only",
+		"--format="+gitLogFormat,
+		"--",
+		relativePath,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := parseGitLog(out)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := []revision{}
+	for _, entry := range entries {
+		// With `--name-only`, this is what the article was called in this
+		// commit. Useful since `--follow` crosses renames.
+		if len(entry.paths) > 0 {
+			entry.revision.Path = b.relative(entry.paths[0])
+		}
+
+		revisions = append(revisions, entry.revision)
+	}
+
+	if len(revisions) == 0 {
+		return nil, errors.New("no history for " + relativePath)
+	}
+
+	return revisions, nil
+}
+
+// Paths that start with "./" are relative to the article root
+func (b *gitCLIBackend) Content(revision revision) (string, error) {
+	return b.git("show", revision.Id+":./"+revision.Path)
+}
+
+// Most of the latest commits are usually to articles we want, so read the log
+// `count` commits at a time until we have enough of them.
+func (b *gitCLIBackend) RecentChanges(count int, wanted func(relativePath string) bool) ([]change, error) {
+	// Same idea as `makeHistoryIndex`: follow renames so that older changes
+	// point at what articles are called now.
+	renamedTo := make(map[string]string)
+	changes := []change{}
+
+	for skip := 0; len(changes) < count; skip += count {
+		out, err := b.git(
+			"log",
+			"-M",
+			"--name-status",
+			"--format="+gitLogFormat,
+			"--max-count="+strconv.Itoa(count),
+			"--skip="+strconv.Itoa(skip),
+			"--",
+			"*.md",
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		entries, err := parseGitLog(out)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if len(changes) == count {
+				break
+			}
+
+			if c, ok := keepWantedPaths(b.changeFromLogEntry(entry, renamedTo), wanted); ok {
+				changes = append(changes, c)
+			}
+		}
+
+		if len(entries) < count {
+			break
+		}
+	}
+
+	return changes, nil
+}
+
+// The change in a `git log --name-status` entry, with what articles are called
+// now. `renamedTo` is updated with any renames in it.
+func (b *gitCLIBackend) changeFromLogEntry(entry gitLogEntry, renamedTo map[string]string) change {
+	changed := []string{}
+
+	// Lines look like "M\tpath" or "R100\told path\tnew path"
+	for _, line := range entry.paths {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 || fields[0] == "D" {
+			continue
+		}
+
+		from, to := b.relative(fields[1]), b.relative(fields[len(fields)-1])
+
+		name, renamed := renamedTo[to]
+		if !renamed {
+			name = to
+		} else if name == "" {
+			continue
+		}
+
+		changed = append(changed, name)
+
+		if from != to {
+			renamedTo[from] = name
+			renamedTo[to] = ""
+		}
+	}
+
+	return makeChange(entry.revision, changed)
+}
+
+type gitLogEntry struct {
+	revision revision
+
+	// Whatever `--name-only` or `--name-status` gave us, line by line
+	paths []string
+}
+
+// Parse the output of `git log --name-(only|status) --format=gitLogFormat`.
+func parseGitLog(out string) ([]gitLogEntry, error) {
+	entries := []gitLogEntry{}
+
+	for _, record := range strings.Split(out, gitRecordSeparator) {
+		fields := strings.Split(record, gitFieldSeparator)
+		if len(fields) != 6 {
+			continue
+		}
+
+		date, err := time.Parse(time.RFC3339, fields[3])
+		if err != nil {
+			return nil, err
+		}
+
+		paths := []string{}
+		for _, p := range strings.Split(fields[5], "\n") {
+			if p = strings.TrimSpace(p); p != "" {
+				paths = append(paths, p)
+			}
+		}
+
+		subject, body := splitCommitMessage(fields[4])
+
+		entries = append(entries, gitLogEntry{
+			revision: revision{
+				AuthorEmail: fields[2],
+				AuthorName:  fields[1],
+				Date:        date.UTC(),
+				Id:          fields[0],
+				ShortId:     fields[0][0:8],
+				Subject:     subject,
+				Body:        body,
+			},
+			paths: paths,
+		})
+	}
+
+	return entries, nil
+}
+
+// A path from `git` made relative to the article root
+func (b *gitCLIBackend) relative(path string) string {
+	return strings.TrimPrefix(path, b.prefix)
+}
+
+// Run a `git` command in the article root and return its standard output.
+func (b *gitCLIBackend) git(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(
+		"git",
+		append([]string{"-C", b.articleRoot, "-c", "core.quotepath=off"}, args...)...,
+	)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", errors.New(message)
+		}
+
+		return "", err
+	}
+
+	return stdout.String(), nil
+}
@@ -0,0 +1,181 @@
+package bock
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// A repository with articles in `folder` (which can be empty) and the same
+// history every time: Old.md is added, renamed to New.md, and edited while
+// Home.md is edited along the way. Untracked.md is never committed.
+func makeTestRepository(t *testing.T, folder string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	articleRoot := filepath.Join(root, folder)
+
+	git := func(date int, args ...string) {
+		t.Helper()
+
+		cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = articleRoot
+
+		stamp := fmt.Sprintf("2024-01-0%dT00:00:00Z", date)
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE="+stamp, "GIT_COMMITTER_DATE="+stamp)
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+
+	write := func(name string, contents string) {
+		t.Helper()
+
+		if err := os.WriteFile(filepath.Join(articleRoot, name), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.MkdirAll(articleRoot, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	git(1, "init", "--quiet", root)
+
+	write("Home.md", "# Home\n")
+	write("Old.md", "# Old\n\nSomething long enough to be seen as a rename.\n")
+	git(1, "add", ".")
+	git(1, "commit", "--quiet", "-m", "Add Home and Old")
+
+	write("Home.md", "# Home\n\nWelcome!\n")
+	git(2, "commit", "--quiet", "-am", "Edit Home")
+
+	git(3, "mv", "Old.md", "New.md")
+	git(3, "commit", "--quiet", "-m", "Rename Old to New")
+
+	write("New.md", "# New\n\nSomething long enough to be seen as a rename.\n")
+	git(4, "commit", "--quiet", "-am", "Edit New", "-m", "It has a body.\n\nWith two paragraphs.")
+
+	write("Untracked.md", "# Untracked\n")
+
+	return articleRoot
+}
+
+func TestGitBackends(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("there's no git")
+	}
+
+	tests := []struct {
+		name    string
+		folder  string
+		backend func(articleRoot string) (gitBackend, error)
+	}{
+		{"go-git", "", func(articleRoot string) (gitBackend, error) {
+			return newGoGitBackend(articleRoot, true)
+		}},
+		{"git", "", func(articleRoot string) (gitBackend, error) {
+			return newGitCLIBackend(articleRoot)
+		}},
+		{"git in a folder", "wiki", func(articleRoot string) (gitBackend, error) {
+			return newGitCLIBackend(articleRoot)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			articleRoot := makeTestRepository(t, tt.folder)
+
+			backend, err := tt.backend(articleRoot)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if backend.IsClean() {
+				t.Error("the working tree is clean, but there's an untracked article")
+			}
+
+			for path, want := range map[string]bool{"Untracked.md": true, "Home.md": false, "New.md": false} {
+				if got := backend.IsUntracked(path); got != want {
+					t.Errorf("IsUntracked(%q) is %v, want %v", path, got, want)
+				}
+			}
+
+			history, err := backend.History("New.md")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := [][2]string{}
+			for _, r := range history {
+				got = append(got, [2]string{r.Subject, r.Path})
+			}
+
+			want := [][2]string{
+				{"Edit New", "New.md"},
+				{"Rename Old to New", "New.md"},
+				{"Add Home and Old", "Old.md"},
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("History(New.md) is %q, want %q", got, want)
+			}
+
+			if body := history[0].Body; body != "It has a body.\n\nWith two paragraphs." {
+				t.Errorf("the latest revision of New.md has the body %q", body)
+			}
+
+			content, err := backend.Content(history[len(history)-1])
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if content != "# Old\n\nSomething long enough to be seen as a rename.\n" {
+				t.Errorf("the first revision of New.md is %q", content)
+			}
+
+			// Only the two latest changes to either article
+			changes, err := backend.RecentChanges(2, func(p string) bool { return p == "New.md" || p == "Home.md" })
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotChanges := [][]string{}
+			for _, c := range changes {
+				gotChanges = append(gotChanges, append([]string{c.Subject}, c.paths...))
+			}
+
+			wantChanges := [][]string{
+				{"Edit New", "New.md"},
+				{"Rename Old to New", "New.md"},
+			}
+
+			if !reflect.DeepEqual(gotChanges, wantChanges) {
+				t.Errorf("RecentChanges(2) is %q, want %q", gotChanges, wantChanges)
+			}
+
+			changes, err = backend.RecentChanges(10, func(p string) bool { return p == "Home.md" })
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotChanges = [][]string{}
+			for _, c := range changes {
+				gotChanges = append(gotChanges, append([]string{c.Subject}, c.paths...))
+			}
+
+			wantChanges = [][]string{
+				{"Edit Home", "Home.md"},
+				{"Add Home and Old", "Home.md"},
+			}
+
+			if !reflect.DeepEqual(gotChanges, wantChanges) {
+				t.Errorf("RecentChanges(10) of Home.md is %q, want %q", gotChanges, wantChanges)
+			}
+		})
+	}
+}
@@ -1,20 +1,19 @@
 // What's a decent project without its kitchen junk-drawer? 🤷‍♂️🤗
 
-package main
+package bock
 
 import (
 	"bytes"
 	"encoding/json"
+	"os"
 	"path/filepath"
 	"strings"
 	"time"
+	"unicode"
 
 	uuid "github.com/satori/go.uuid"
 )
 
-// TODO: Finish this.
-// func runConcurrently(wg *sync.WaitGroup, function func) {}
-
 // The JSON marshaller in Golang's STDLIB cannot be configured to disable HTML
 // escaping. That's what this function does.
 func jsonMarshal(t interface{}) ([]byte, error) {
@@ -33,6 +32,46 @@ func makeURI(path string, articleRoot string) string {
 	return strings.TrimSuffix(uri, filepath.Ext(uri))
 }
 
+// Tags are served at lowercase URIs with anything that isn't a letter, a
+// number, or a dash replaced with an underscore. For example, "Open BSD" is
+// served at `/tags/open_bsd` and "TCP/IP" at `/tags/tcp_ip`. Tags with the same
+// URI are the same tag.
+func makeTagURI(tag string) string {
+	return "/tags/" + strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+			return r
+		}
+
+		return '_'
+	}, strings.ToLower(tag))
+}
+
+// Categories are just tags by another name. Merge them, drop any blank ones,
+// and remove duplicates (including ones that only differ by case).
+func tagsIn(frontmatter frontmatter) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+
+	for _, t := range append(frontmatter.Tags, frontmatter.Categories...) {
+		if t = strings.TrimSpace(t); t != "" && !seen[makeTagURI(t)] {
+			seen[makeTagURI(t)] = true
+			tags = append(tags, t)
+		}
+	}
+
+	return tags
+}
+
+// Folders are served at the same kind of URI as articles. The root folder is
+// the exception and is served at `/ROOT`.
+func makeFolderURI(absolutePath string, config *bockConfig) string {
+	if absolutePath == config.articleRoot {
+		return "/ROOT"
+	}
+
+	return makeURI(absolutePath, config.articleRoot)
+}
+
 func makeRelativePath(path string, articleRoot string) string {
 	return strings.TrimPrefix(strings.Replace(path, articleRoot, "", -1), "/")
 }
@@ -103,7 +142,7 @@ func makeID(path string) string {
 // Return the array index of entity with the given name if exists in another
 // entity's list of children. If it doesn't exist, return -1. Helper function
 // for `makeEntityTree`.
-func findChildWithName(children *[]Entity, name string) int {
+func findChildWithName(children *[]entity, name string) int {
 	for index, c := range *children {
 		if c.Name == name {
 			return index
@@ -112,3 +151,9 @@ func findChildWithName(children *[]Entity, name string) int {
 
 	return -1
 }
+
+// Whether we can redraw lines or should just print them one after the other
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
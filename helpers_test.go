@@ -0,0 +1,68 @@
+package bock
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMakeTagURI(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+	}{
+		{"linux", "/tags/linux"},
+		{"Open BSD", "/tags/open_bsd"},
+		{"TCP/IP", "/tags/tcp_ip"},
+		{"C#", "/tags/c_"},
+		{"100% Done?", "/tags/100__done_"},
+		{"..", "/tags/__"},
+		{"Café-Crème", "/tags/café-crème"},
+	}
+
+	for _, tt := range tests {
+		if got := makeTagURI(tt.tag); got != tt.want {
+			t.Errorf("makeTagURI(%q) is %q, want %q", tt.tag, got, tt.want)
+		}
+	}
+}
+
+func TestTagsIn(t *testing.T) {
+	got := tagsIn(frontmatter{
+		Tags:       []string{"Linux", " ", "linux", "Open BSD"},
+		Categories: []string{"open bsd", "Networking"},
+	})
+
+	want := []string{"Linux", "Open BSD", "Networking"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestMakeListOfTags(t *testing.T) {
+	config := bockConfig{listOfArticles: &[]entity{
+		{Title: "pf", URI: "/pf", Tags: []string{"BSD", "Firewalls"}},
+		{Title: "iptables", URI: "/iptables", Tags: []string{"Linux", "firewalls"}},
+		{Title: "nftables", URI: "/nftables", Tags: []string{"firewalls"}},
+	}}
+
+	got := []tag{}
+	for _, t := range makeListOfTags(&config) {
+		names := []hierarchicalEntity{}
+		for _, a := range t.Articles {
+			names = append(names, hierarchicalEntity{Name: a.Name})
+		}
+
+		got = append(got, tag{Name: t.Name, URI: t.URI, Articles: names})
+	}
+
+	want := []tag{
+		{Name: "BSD", URI: "/tags/bsd", Articles: []hierarchicalEntity{{Name: "pf"}}},
+		{Name: "firewalls", URI: "/tags/firewalls", Articles: []hierarchicalEntity{{Name: "iptables"}, {Name: "nftables"}, {Name: "pf"}}},
+		{Name: "Linux", URI: "/tags/linux", Articles: []hierarchicalEntity{{Name: "iptables"}}},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,205 @@
+package bock
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Asking `go-git` for the log of a single file is painfully slow since it has
+// to look at every commit and every file in it. And we used to do this for
+// every article! Instead, walk the commit graph exactly once, diff each commit
+// against its parent(s), and note which articles changed. The resulting map of
+// relative article paths to their revisions (newest first) is read-only once
+// built and shared by everything that writes articles.
+//
+// Renames and moves are followed (like `git log --follow`) so an article's
+// history carries across them. Each revision records the path the article had
+// in that commit.
+//
+// Since we're looking at every commit anyway, also make a list of all the
+// commits that changed articles (newest first) for the "Recent Changes" page
+// and the feeds.
+//
+// Revision contents are NOT loaded here. A wiki with thousands of articles and
+// tens of thousands of commits would need a lot of memory for that. We hold on
+// to the blob hash instead and load the contents when a revision is written.
+func makeHistoryIndex(repository *git.Repository) (map[string][]revision, []change, error) {
+	index := make(map[string][]revision)
+	changeList := []change{}
+
+	head, err := repository.Head()
+	if err != nil {
+		return index, changeList, err
+	}
+
+	commits, err := repository.Log(&git.LogOptions{
+		From:  head.Hash(),
+		Order: git.LogOrderCommitterTime,
+	})
+	if err != nil {
+		return index, changeList, err
+	}
+
+	// We walk from newest to oldest. When we see that an article was renamed,
+	// older commits will know it by its old name. This maps those old names to
+	// what the article is called now. An empty string means that whatever was
+	// at that path before is NOT the article that's there now.
+	renamedTo := make(map[string]string)
+
+	err = commits.ForEach(func(c *object.Commit) error {
+		changes, err := changesInCommit(c)
+		if err != nil {
+			return err
+		}
+
+		changed := []string{}
+
+		for _, change := range changes {
+			// Deleted things (no destination) and things that aren't articles
+			if change.To.Name == "" || filepath.Ext(change.To.Name) != ".md" {
+				continue
+			}
+
+			name, renamed := renamedTo[change.To.Name]
+			if !renamed {
+				name = change.To.Name
+			} else if name == "" {
+				continue
+			}
+
+			rev := makeRevision(c)
+			rev.blobHash = change.To.TreeEntry.Hash
+			rev.Path = change.To.Name
+
+			index[name] = append(index[name], rev)
+			changed = append(changed, name)
+
+			if change.From.Name != "" && change.From.Name != change.To.Name {
+				renamedTo[change.From.Name] = name
+				renamedTo[change.To.Name] = ""
+			}
+		}
+
+		if len(changed) > 0 {
+			changeList = append(changeList, makeChange(makeRevision(c), changed))
+		}
+
+		return nil
+	})
+
+	sort.SliceStable(changeList, func(i, j int) bool {
+		return changeList[i].Date.After(changeList[j].Date)
+	})
+
+	for _, revisions := range index {
+		sort.SliceStable(revisions, func(i, j int) bool {
+			return revisions[i].Date.After(revisions[j].Date)
+		})
+	}
+
+	return index, changeList, err
+}
+
+// Figure out what a commit changed. The root commit is diffed against an empty
+// tree. Merge commits only count as having changed a path if it's different
+// from what's in *every* parent. Otherwise we'd count the same change twice:
+// once on the branch where it was made and then again when it was merged.
+func changesInCommit(c *object.Commit) (object.Changes, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.NumParents() == 0 {
+		return diffTrees(nil, tree)
+	}
+
+	var changes object.Changes
+	changedInParents := make(map[string]int)
+
+	for i := 0; i < c.NumParents(); i++ {
+		parent, err := c.Parent(i)
+		if err != nil {
+			return nil, err
+		}
+
+		parentTree, err := parent.Tree()
+		if err != nil {
+			return nil, err
+		}
+
+		parentChanges, err := diffTrees(parentTree, tree)
+		if err != nil {
+			return nil, err
+		}
+
+		if i == 0 {
+			changes = parentChanges
+		}
+
+		for _, change := range parentChanges {
+			changedInParents[change.To.Name] += 1
+		}
+	}
+
+	if c.NumParents() == 1 {
+		return changes, nil
+	}
+
+	var mergeChanges object.Changes
+	for _, change := range changes {
+		if changedInParents[change.To.Name] == c.NumParents() {
+			mergeChanges = append(mergeChanges, change)
+		}
+	}
+
+	return mergeChanges, nil
+}
+
+// Diff two trees and pair up deletions and insertions that look like renames.
+func diffTrees(from *object.Tree, to *object.Tree) (object.Changes, error) {
+	return object.DiffTreeWithOptions(
+		context.Background(),
+		from,
+		to,
+		object.DefaultDiffTreeOptions,
+	)
+}
+
+func makeRevision(c *object.Commit) revision {
+	subject, body := splitCommitMessage(c.Message)
+
+	return revision{
+		AuthorEmail: c.Author.Email,
+		AuthorName:  c.Author.Name,
+		Body:        body,
+		Date:        c.Author.When.UTC(),
+		Id:          c.Hash.String(),
+		ShortId:     c.Hash.String()[0:8],
+		Subject:     subject,
+	}
+}
+
+// The first line of a commit message, and whatever comes after it
+func splitCommitMessage(message string) (string, string) {
+	subject, body, _ := strings.Cut(strings.TrimSpace(message), "\n")
+	return strings.TrimSpace(subject), strings.TrimSpace(body)
+}
+
+func makeChange(revision revision, paths []string) change {
+	return change{
+		AuthorEmail: revision.AuthorEmail,
+		AuthorName:  revision.AuthorName,
+		Body:        revision.Body,
+		Date:        revision.Date,
+		Id:          revision.Id,
+		ShortId:     revision.ShortId,
+		Subject:     revision.Subject,
+		paths:       paths,
+	}
+}
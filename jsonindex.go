@@ -0,0 +1,235 @@
+package bock
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// For hosts that won't serve `.wasm` files (or anything as big as
+// `articles.db`), the archive page can search a prebuilt index instead. It's
+// made from the titles, descriptions, tags, and contents in `articles.db` and
+// split into JSON files by the first searchIndexPrefixLength letters of
+// each word, so a search only downloads the words it might match:
+//
+//	/search/index.json   Every article, and which of these files there are
+//	/search/pf.json      {"pf": [[3, 12], ...], "pfctl": [[3, 2]]}
+//
+// Every word lists the articles it's in, by where they are in `index.json`,
+// with a score. Articles with the word in their title or tags score higher.
+// Prefixes that aren't just `a-z` and `0-9` are named `_` followed by their
+// UTF-8 in hex, like `_c3a9.json` for "é".
+
+// Bump this whenever the format above changes
+const searchIndexVersion = 1
+
+type searchIndexArticle struct {
+	URI         string   `json:"uri"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
+
+type searchIndexManifest struct {
+	Version      int                  `json:"version"`
+	PrefixLength int                  `json:"prefixLength"`
+	Articles     []searchIndexArticle `json:"articles"`
+	Shards       []string             `json:"shards"`
+}
+
+func isSearchIndex(searchIndex string) bool {
+	switch searchIndex {
+	case SearchIndexSQLite, SearchIndexJSON, SearchIndexBoth:
+		return true
+	}
+
+	return false
+}
+
+// Whether the archive page can search `articles.db` and the JSON index
+func (m meta) searchesDatabase() bool {
+	return m.SearchIndex != SearchIndexJSON
+}
+
+func (m meta) searchesJSON() bool {
+	return m.SearchIndex == SearchIndexJSON || m.SearchIndex == SearchIndexBoth
+}
+
+// What the database is called in the output
+func databaseName(searchIndex string) string {
+	if searchIndex == SearchIndexJSON {
+		return privateDatabaseName
+	}
+
+	return publicDatabaseName
+}
+
+// Lowercase runs of letters and numbers. Single letters aren't worth indexing.
+func searchIndexWords(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	long := words[:0]
+	for _, w := range words {
+		if len([]rune(w)) > 1 {
+			long = append(long, w)
+		}
+	}
+
+	return long
+}
+
+// Which file a word is in
+func searchIndexShard(word string) string {
+	prefix := []rune(word)
+	if len(prefix) > searchIndexPrefixLength {
+		prefix = prefix[:searchIndexPrefixLength]
+	}
+
+	for _, r := range prefix {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return "_" + hex.EncodeToString([]byte(string(prefix)))
+		}
+	}
+
+	return string(prefix)
+}
+
+// Write the JSON search index from what's in the database. It's small enough
+// to write from scratch every time.
+func writeJSONSearchIndex(config *bockConfig) error {
+	rows, err := config.database.Query(`
+    SELECT
+      uri,
+      title,
+      COALESCE(description, ''),
+      COALESCE(tags, ''),
+      COALESCE(content, '')
+    FROM articles
+    ORDER BY uri
+  `)
+	if err != nil {
+		return fmt.Errorf("could not read the database: %w", err)
+	}
+
+	defer rows.Close()
+
+	manifest := searchIndexManifest{
+		Version:      searchIndexVersion,
+		PrefixLength: searchIndexPrefixLength,
+		Articles:     []searchIndexArticle{},
+		Shards:       []string{},
+	}
+
+	// Word -> article -> score
+	scores := map[string]map[int]int{}
+
+	score := func(article int, text string, weight int) {
+		for _, w := range searchIndexWords(text) {
+			if scores[w] == nil {
+				scores[w] = map[int]int{}
+			}
+
+			scores[w][article] += weight
+		}
+	}
+
+	for rows.Next() {
+		var article searchIndexArticle
+		var tags, content string
+
+		if err := rows.Scan(&article.URI, &article.Title, &article.Description, &tags, &content); err != nil {
+			return fmt.Errorf("could not read the database: %w", err)
+		}
+
+		article.Tags = []string{}
+		if tags != "" {
+			article.Tags = strings.Split(tags, ",")
+		}
+
+		i := len(manifest.Articles)
+		manifest.Articles = append(manifest.Articles, article)
+
+		score(i, article.Title, 10)
+		score(i, tags, 5)
+		score(i, article.Description, 2)
+		score(i, content, 1)
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("could not read the database: %w", err)
+	}
+
+	// Best matches first
+	shards := map[string]map[string][][2]int{}
+
+	for w, articles := range scores {
+		postings := make([][2]int, 0, len(articles))
+		for a, s := range articles {
+			postings = append(postings, [2]int{a, s})
+		}
+
+		sort.Slice(postings, func(i, j int) bool {
+			if postings[i][1] != postings[j][1] {
+				return postings[i][1] > postings[j][1]
+			}
+
+			return postings[i][0] < postings[j][0]
+		})
+
+		shard := searchIndexShard(w)
+		if shards[shard] == nil {
+			shards[shard] = map[string][][2]int{}
+		}
+
+		shards[shard][w] = postings
+	}
+
+	// Words that aren't in any article anymore take their files with them
+	if err := config.output.RemoveAll(searchIndexFolder); err != nil {
+		return err
+	}
+
+	for shard, words := range shards {
+		contents, err := json.Marshal(words)
+		if err != nil {
+			return err
+		}
+
+		if err := writeFile("/"+searchIndexFolder+"/"+shard+".json", contents, config); err != nil {
+			return err
+		}
+
+		manifest.Shards = append(manifest.Shards, shard)
+	}
+
+	sort.Strings(manifest.Shards)
+
+	contents, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+
+	return writeFile("/"+searchIndexFolder+"/index.json", contents, config)
+}
+
+// Get rid of whatever a build with a different search index left behind
+func removeOtherSearchIndexes(config *bockConfig) {
+	if !config.meta.searchesJSON() {
+		config.output.RemoveAll(searchIndexFolder)
+	}
+
+	if config.meta.searchesDatabase() {
+		config.output.Remove(privateDatabaseName)
+	} else {
+		config.output.Remove(publicDatabaseName)
+
+		for _, f := range sqlJSFiles {
+			config.output.Remove(f)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package bock
+
+import (
+	"context"
+	"encoding/json"
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+func TestSearchIndexWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"How to reload pf.conf", []string{"how", "to", "reload", "pf", "conf"}},
+		{"A b-c d", []string{}},
+		{"IPv6 über Straße", []string{"ipv6", "über", "straße"}},
+		{"日本語 テキスト", []string{"日本語", "テキスト"}},
+		{"", []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := searchIndexWords(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("searchIndexWords(%q) is %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSearchIndexShard(t *testing.T) {
+	tests := []struct {
+		word string
+		want string
+	}{
+		{"pfctl", "pf"},
+		{"ipv6", "ip"},
+		{"42nd", "42"},
+		{"über", "_c3bc62"},
+		{"éa", "_c3a961"},
+		{"日本語", "_e697a5e69cac"},
+		{"x", "x"},
+	}
+
+	for _, tt := range tests {
+		if got := searchIndexShard(tt.word); got != tt.want {
+			t.Errorf("searchIndexShard(%q) is %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestWriteJSONSearchIndex(t *testing.T) {
+	root := makeTestWiki(t, map[string]string{
+		"Home.md":     "# Home\n",
+		"Tech/pf.md":  "---\ntags: [BSD]\ndescription: Packet filter\n---\n# pf\n\nReload with pfctl.\n",
+		"Über uns.md": "# Über uns\n\nPfannkuchen\n",
+	})
+
+	output := NewMemoryOutput()
+
+	if _, err := Build(context.Background(), Options{
+		ArticleRoot: root,
+		Output:      output,
+		SearchIndex: SearchIndexJSON,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.Stat(output, publicDatabaseName); err == nil {
+		t.Errorf("there's a %s with just the JSON index", publicDatabaseName)
+	}
+
+	var manifest searchIndexManifest
+	readJSON(t, output, searchIndexFolder+"/index.json", &manifest)
+
+	articles := map[string]int{}
+	for i, a := range manifest.Articles {
+		articles[a.URI] = i
+	}
+
+	pf, ok := articles["/Tech/pf"]
+	if !ok {
+		t.Fatalf("pf isn't in the index: %+v", manifest.Articles)
+	}
+
+	if a := manifest.Articles[pf]; a.Description != "Packet filter" || !reflect.DeepEqual(a.Tags, []string{"BSD"}) {
+		t.Errorf("pf is %+v", a)
+	}
+
+	uber, ok := articles["/Über_uns"]
+	if !ok {
+		t.Fatalf("Über uns isn't in the index: %+v", manifest.Articles)
+	}
+
+	// Every shard in the manifest is there, and has words in it
+	for _, shard := range manifest.Shards {
+		var words map[string][][2]int
+		readJSON(t, output, searchIndexFolder+"/"+shard+".json", &words)
+
+		if len(words) == 0 {
+			t.Errorf("%s is empty", shard)
+		}
+	}
+
+	// Titles score higher than contents
+	var pfShard map[string][][2]int
+	readJSON(t, output, searchIndexFolder+"/pf.json", &pfShard)
+
+	if want := [][2]int{{pf, 11}}; !reflect.DeepEqual(pfShard["pf"], want) {
+		t.Errorf("pf is in %v, want %v", pfShard["pf"], want)
+	}
+
+	if want := [][2]int{{uber, 1}}; !reflect.DeepEqual(pfShard["pfannkuchen"], want) {
+		t.Errorf("pfannkuchen is in %v, want %v", pfShard["pfannkuchen"], want)
+	}
+
+	var uberShard map[string][][2]int
+	readJSON(t, output, searchIndexFolder+"/"+searchIndexShard("über")+".json", &uberShard)
+
+	if want := [][2]int{{uber, 11}}; !reflect.DeepEqual(uberShard["über"], want) {
+		t.Errorf("über is in %v, want %v", uberShard["über"], want)
+	}
+}
+
+func readJSON(t *testing.T, fsys fs.FS, name string, v interface{}) {
+	t.Helper()
+
+	contents, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal(contents, v); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+}
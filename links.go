@@ -0,0 +1,153 @@
+package bock
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Who links to whom. Built from every article before anything is written so
+// that each article can list the articles that link to it ("What links here").
+// Everything is keyed by URI.
+type linkGraph struct {
+	// Articles each article links to. Links to articles that don't exist are
+	// kept (with a `?` in front) so we can tell when they start to exist.
+	outgoing map[string][]string
+
+	// Articles that link to each article, sorted by name
+	backlinks map[string][]hierarchicalEntity
+
+	// The ID of each article, for the database
+	ids map[string]string
+}
+
+// Parse an article (without its frontmatter) but don't render it. Also returns
+// the Markdown that was parsed and how far into the file it starts.
+func parseArticle(articlePath string, config *bockConfig) (ast.Node, []byte, int, error) {
+	contents, err := readArticleFile(articlePath, config)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	document, body, offset := parseArticleContents(contents, config)
+
+	return document, body, offset, nil
+}
+
+func parseArticleContents(contents []byte, config *bockConfig) (ast.Node, []byte, int) {
+	_, body, _ := parseFrontmatter(contents)
+
+	pc, _ := newMarkdownContext(config.wikiLinks)
+	document := markdown.Parser().Parse(text.NewReader(body), parser.WithContext(pc))
+
+	return document, body, len(contents) - len(body)
+}
+
+// Where a link in an article leads, if it's to another article. Regular
+// Markdown links count as long as they're to an article's URI.
+func linkDestination(node ast.Node, articlesByURI map[string]hierarchicalEntity) (string, bool) {
+	var destination string
+
+	switch n := node.(type) {
+	case *wikiLink:
+		if n.Missing {
+			return "?" + n.Destination, true
+		}
+
+		destination = n.Destination
+
+	case *ast.Link:
+		destination = string(n.Destination)
+
+	default:
+		return "", false
+	}
+
+	destination, _, _ = strings.Cut(destination, "#")
+	destination, _, _ = strings.Cut(destination, "?")
+	destination = strings.TrimSuffix(destination, "/")
+
+	if _, ok := articlesByURI[destination]; !ok {
+		return "", false
+	}
+
+	return destination, true
+}
+
+// Parse every article (but don't render it) and collect its links
+func makeLinkGraph(config *bockConfig) *linkGraph {
+	graph := &linkGraph{
+		outgoing:  make(map[string][]string),
+		backlinks: make(map[string][]hierarchicalEntity),
+		ids:       make(map[string]string),
+	}
+
+	articlesByURI := map[string]hierarchicalEntity{
+		config.site.HomeURI: {Name: config.site.Home, Type: "article", URI: config.site.HomeURI},
+	}
+
+	paths := map[string]string{
+		config.site.HomeURI: config.articleRoot + "/" + config.site.Home + ".md",
+	}
+
+	for _, a := range *config.listOfArticles {
+		articlesByURI[a.URI] = hierarchicalEntity{Name: a.Title, Type: "article", URI: a.URI}
+		paths[a.URI] = a.path
+	}
+
+	for uri, articlePath := range paths {
+		graph.ids[uri] = makeID(articlePath)
+
+		document, _, _, err := parseArticle(articlePath, config)
+		if err != nil {
+			continue
+		}
+
+		seen := make(map[string]bool)
+
+		ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+			if !entering {
+				return ast.WalkContinue, nil
+			}
+
+			destination, ok := linkDestination(node, articlesByURI)
+			if !ok || seen[destination] || destination == uri {
+				return ast.WalkContinue, nil
+			}
+
+			seen[destination] = true
+			graph.outgoing[uri] = append(graph.outgoing[uri], destination)
+
+			if !strings.HasPrefix(destination, "?") {
+				graph.backlinks[destination] = append(graph.backlinks[destination], articlesByURI[uri])
+			}
+
+			return ast.WalkContinue, nil
+		})
+	}
+
+	for uri := range graph.backlinks {
+		sort.Slice(graph.backlinks[uri], func(i, j int) bool {
+			return strings.ToLower(graph.backlinks[uri][i].Name) < strings.ToLower(graph.backlinks[uri][j].Name)
+		})
+	}
+
+	return graph
+}
+
+// What an article's links look like, as a hash. If it changes, the article has
+// to be rendered again.
+func (graph *linkGraph) signature(uri string) string {
+	outgoing := append([]string{}, graph.outgoing[uri]...)
+	sort.Strings(outgoing)
+
+	backlinks := []string{}
+	for _, b := range graph.backlinks[uri] {
+		backlinks = append(backlinks, b.URI+" "+b.Name)
+	}
+
+	return hashOf([]byte(strings.Join(outgoing, "\n") + "\n\n" + strings.Join(backlinks, "\n")))
+}
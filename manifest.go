@@ -0,0 +1,202 @@
+package bock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+)
+
+// The build manifest lets us skip work on subsequent runs. It's written to the
+// output folder at the end of every build and records what each article looked
+// like when it was last rendered. If an article's source, its latest commit,
+// where its wiki links lead, and the templates haven't changed since, we leave
+// its output alone.
+type manifestEntry struct {
+	Hash       string `json:"hash"`
+	ID         string `json:"id"`
+	LastCommit string `json:"lastCommit"`
+	Links      string `json:"links"`
+	URI        string `json:"uri"`
+}
+
+type manifest struct {
+	// Keyed by the article's path relative to the article root
+	Articles map[string]manifestEntry `json:"articles"`
+
+	// URIs of everything else we generated. We need these to clean up folders
+	// and tags that no longer exist.
+	Folders []string `json:"folders"`
+	Tags    []string `json:"tags"`
+
+	// A fingerprint of the templates and the flags that affect every page.
+	// Everything is rebuilt if this changes.
+	TemplateVersion string `json:"templateVersion"`
+	Version         string `json:"version"`
+
+	// Articles are written concurrently
+	mutex sync.Mutex
+}
+
+func hashOf(contents []byte) string {
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
+
+// Fingerprint the templates (yours and the embedded ones), the site config,
+// this version of bock, and anything else that changes what every single page
+// looks like.
+func makeTemplateVersion(config *bockConfig) string {
+	hash := sha256.New()
+
+	fs.WalkDir(config.templates, ".", func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			contents, _ := fs.ReadFile(config.templates, path)
+			hash.Write([]byte(path))
+			hash.Write(contents)
+		}
+
+		return nil
+	})
+
+	fmt.Fprint(
+		hash,
+		version,
+		config.baseURL,
+		config.meta.GenerateJSON,
+		config.meta.GenerateRaw,
+		config.meta.GenerateRevisions,
+		config.meta.TagCount > 0,
+		fmt.Sprintf("%+v", config.site),
+	)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Read the manifest from a previous build. Returns nil if there isn't one or it
+// can't be read: we'll just build everything.
+func readManifest(config *bockConfig) *manifest {
+	contents, err := fs.ReadFile(config.output, manifestName)
+	if err != nil {
+		return nil
+	}
+
+	manifest := manifest{}
+	if err := json.Unmarshal(contents, &manifest); err != nil || manifest.Articles == nil {
+		return nil
+	}
+
+	return &manifest
+}
+
+func writeManifest(config *bockConfig) error {
+	config.manifest.Folders = []string{}
+	for _, f := range *config.listOfFolders {
+		config.manifest.Folders = append(config.manifest.Folders, makeFolderURI(f, config))
+	}
+
+	config.manifest.Tags = []string{}
+	for _, t := range *config.listOfTags {
+		config.manifest.Tags = append(config.manifest.Tags, t.URI)
+	}
+
+	jsonData, err := jsonMarshal(config.manifest)
+	if err != nil {
+		return err
+	}
+
+	return writeFile("/"+manifestName, jsonData, config)
+}
+
+// Note what we're about to write for an article. Returns true if it's exactly
+// what we wrote the last time and can be skipped.
+func recordInManifest(relativePath string, entry manifestEntry, config *bockConfig) bool {
+	config.manifest.mutex.Lock()
+	config.manifest.Articles[relativePath] = entry
+	config.manifest.mutex.Unlock()
+
+	if config.previousManifest == nil {
+		return false
+	}
+
+	previous, ok := config.previousManifest.Articles[relativePath]
+
+	return ok && previous == entry
+}
+
+// Leave an article out of the manifest because we couldn't write it (or one
+// of its revisions). The next build will try again.
+func forgetInManifest(relativePath string, config *bockConfig) {
+	config.manifest.mutex.Lock()
+	defer config.manifest.mutex.Unlock()
+
+	delete(config.manifest.Articles, relativePath)
+}
+
+// Remove whatever a previous build wrote for articles, folders, and tags that
+// no longer exist. This happens *before* we write anything since, for example,
+// a deleted article `/Foo` and a new folder `/Foo` share an output folder.
+func removeStaleOutput(config *bockConfig) error {
+	if config.previousManifest == nil {
+		return nil
+	}
+
+	current := make(map[string]bool)
+	for _, a := range *config.listOfArticles {
+		current[a.RelativePath] = true
+	}
+
+	for relativePath, entry := range config.previousManifest.Articles {
+		if current[relativePath] {
+			continue
+		}
+
+		fmt.Fprintln(config.log, "Removing", relativePath)
+
+		prefix := strings.TrimPrefix(entry.URI, "/")
+		for _, f := range []string{"index.html", "index.json", "raw.txt"} {
+			config.output.Remove(prefix + "/" + f)
+		}
+		config.output.RemoveAll(prefix + "/revisions")
+		config.output.Remove(prefix)
+
+		if _, err := config.database.Exec(`DELETE FROM articles WHERE id = ?`, entry.ID); err != nil {
+			return fmt.Errorf("could not remove '%s' from the database: %w", relativePath, err)
+		}
+	}
+
+	// Folders and tags only have an HTML page and maybe some JSON
+	removePages := func(previous []string, now []string) {
+		exists := make(map[string]bool)
+		for _, uri := range now {
+			exists[uri] = true
+		}
+
+		for _, uri := range previous {
+			if !exists[uri] {
+				name := strings.TrimPrefix(uri, "/")
+				config.output.Remove(name + "/index.html")
+				config.output.Remove(name + "/index.json")
+				config.output.Remove(name)
+			}
+		}
+	}
+
+	folders := []string{}
+	for _, f := range *config.listOfFolders {
+		folders = append(folders, makeFolderURI(f, config))
+	}
+
+	tags := []string{}
+	for _, t := range *config.listOfTags {
+		tags = append(tags, t.URI)
+	}
+
+	removePages(config.previousManifest.Folders, folders)
+	removePages(config.previousManifest.Tags, tags)
+
+	return nil
+}
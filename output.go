@@ -0,0 +1,220 @@
+package bock
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+)
+
+// Where a build goes. Names are slash-separated and relative to the root of
+// the output, like `Tech/pf/index.html`. Reading from an output (it's an
+// `fs.FS`) is how builds figure out what a previous build left there, so
+// outputs that can't be read from (like archives) are always built from
+// scratch. Outputs are written to from several goroutines at once.
+type Output interface {
+	fs.FS
+
+	WriteFile(name string, contents []byte) error
+
+	// Remove a file, or a folder if there's nothing in it
+	Remove(name string) error
+
+	// Remove a file or a folder and everything in it
+	RemoveAll(name string) error
+
+	// Finish writing. Builds don't do this; whoever made the output does.
+	Close() error
+}
+
+// Outputs that can't be read from
+type writeOnlyOutput struct{}
+
+func (writeOnlyOutput) Open(name string) (fs.File, error) {
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (writeOnlyOutput) Remove(name string) error    { return nil }
+func (writeOnlyOutput) RemoveAll(name string) error { return nil }
+
+// A folder on disk. This is what `--out` is.
+type DirOutput struct {
+	fs.FS
+	folder string
+}
+
+func NewDirOutput(folder string) *DirOutput {
+	return &DirOutput{
+		FS:     os.DirFS(folder),
+		folder: folder,
+	}
+}
+
+func (o *DirOutput) path(name string) string {
+	return filepath.Join(o.folder, filepath.FromSlash(name))
+}
+
+func (o *DirOutput) WriteFile(name string, contents []byte) error {
+	p := o.path(name)
+
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return err
+	}
+
+	return os.WriteFile(p, contents, os.ModePerm)
+}
+
+func (o *DirOutput) Remove(name string) error {
+	return os.Remove(o.path(name))
+}
+
+func (o *DirOutput) RemoveAll(name string) error {
+	return os.RemoveAll(o.path(name))
+}
+
+func (o *DirOutput) Close() error {
+	return nil
+}
+
+// Everything in memory. `bock serve` uses this when there's no output folder.
+// It can be built into again, just like a folder.
+type MemoryOutput struct {
+	mutex sync.RWMutex
+	files fstest.MapFS
+}
+
+func NewMemoryOutput() *MemoryOutput {
+	return &MemoryOutput{files: fstest.MapFS{}}
+}
+
+func (o *MemoryOutput) Open(name string) (fs.File, error) {
+	o.mutex.RLock()
+	defer o.mutex.RUnlock()
+
+	return o.files.Open(name)
+}
+
+func (o *MemoryOutput) WriteFile(name string, contents []byte) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	// Files are replaced and never changed so anything that has one open
+	// keeps reading what it opened
+	o.files[name] = &fstest.MapFile{
+		Data:    append([]byte{}, contents...),
+		Mode:    0o644,
+		ModTime: time.Now(),
+	}
+
+	return nil
+}
+
+// Folders in memory are only there because something is in them
+func (o *MemoryOutput) Remove(name string) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	delete(o.files, name)
+
+	return nil
+}
+
+func (o *MemoryOutput) RemoveAll(name string) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	for f := range o.files {
+		if f == name || strings.HasPrefix(f, name+"/") {
+			delete(o.files, f)
+		}
+	}
+
+	return nil
+}
+
+func (o *MemoryOutput) Close() error {
+	return nil
+}
+
+// A tar archive streamed to `w`. Closing it finishes the archive but doesn't
+// close `w`.
+type TarOutput struct {
+	writeOnlyOutput
+	mutex  sync.Mutex
+	writer *tar.Writer
+}
+
+func NewTarOutput(w io.Writer) *TarOutput {
+	return &TarOutput{writer: tar.NewWriter(w)}
+}
+
+func (o *TarOutput) WriteFile(name string, contents []byte) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	header := &tar.Header{
+		Name:    path.Clean(name),
+		Mode:    0o644,
+		Size:    int64(len(contents)),
+		ModTime: time.Now(),
+	}
+
+	if err := o.writer.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err := o.writer.Write(contents)
+
+	return err
+}
+
+func (o *TarOutput) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return o.writer.Close()
+}
+
+// A zip archive streamed to `w`. Closing it finishes the archive but doesn't
+// close `w`.
+type ZipOutput struct {
+	writeOnlyOutput
+	mutex  sync.Mutex
+	writer *zip.Writer
+}
+
+func NewZipOutput(w io.Writer) *ZipOutput {
+	return &ZipOutput{writer: zip.NewWriter(w)}
+}
+
+func (o *ZipOutput) WriteFile(name string, contents []byte) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	f, err := o.writer.CreateHeader(&zip.FileHeader{
+		Name:     path.Clean(name),
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(contents)
+
+	return err
+}
+
+func (o *ZipOutput) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	return o.writer.Close()
+}
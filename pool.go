@@ -0,0 +1,100 @@
+package bock
+
+import "context"
+
+// A job is one unit of work for the worker pool: writing an article, a folder,
+// a tag, or a single revision. A job can queue more jobs when it's done. For
+// example, an article queues its revisions once their contents are loaded.
+type job struct {
+	name string
+	run  func() jobResult
+}
+
+// What a job did. Workers never touch `config.meta` directly; the counts here
+// are added up by whoever collects the results.
+type jobResult struct {
+	name      string
+	article   string // The article this job was for, if any
+	articles  int
+	folders   int
+	tags      int
+	revisions int
+	warnings  []string
+	err       error
+	next      []job
+}
+
+// Run jobs on a fixed number of workers until there are none left. A single
+// dispatcher (the calling goroutine) owns the queue and hands jobs out to the
+// workers, so a job that queues more jobs can never block on a full channel.
+// Results are passed to `collect` on the calling goroutine as they come in.
+// If `collect` returns false or the context is cancelled, no more jobs are
+// handed out (including any that running jobs queue when they finish) and we
+// return once the ones already running are done.
+func runJobs(ctx context.Context, queue []job, workers int, collect func(jobResult) bool) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	jobs := make(chan job)
+	results := make(chan jobResult)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for j := range jobs {
+				result := j.run()
+				result.name = j.name
+				results <- result
+			}
+		}()
+	}
+
+	cancelled := ctx.Done()
+	running := 0
+	stopped := false
+
+	for len(queue) > 0 || running > 0 {
+		// `select` picks at random when it could both hand out a job and
+		// notice the cancellation, so check first
+		if !stopped && ctx.Err() != nil {
+			stopped = true
+			queue = nil
+		}
+
+		// Sending on a nil channel blocks forever, which takes the first case
+		// out of the `select` when there's nothing left to hand out.
+		var send chan job
+		var next job
+
+		if len(queue) > 0 {
+			send = jobs
+			next = queue[0]
+		}
+
+		select {
+		case send <- next:
+			queue = queue[1:]
+			running++
+
+		case result := <-results:
+			running--
+
+			if !stopped {
+				queue = append(queue, result.next...)
+			}
+
+			if !collect(result) {
+				stopped = true
+				queue = nil
+			}
+
+		case <-cancelled:
+			// Only once. After this, we're just waiting on what's running.
+			stopped = true
+			queue = nil
+			cancelled = nil
+		}
+	}
+
+	close(jobs)
+}
@@ -0,0 +1,88 @@
+package bock
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Jobs that queue more jobs when they're done, like articles queue revisions.
+// The first `together` of them wait for each other so they're all running at
+// the same time.
+func makeQueueingJobs(count int, children int, together int, ran *int64) []job {
+	queue := []job{}
+
+	var started sync.WaitGroup
+	started.Add(together)
+
+	for i := 0; i < count; i++ {
+		i := i
+		queue = append(queue, job{
+			name: "parent",
+			run: func() jobResult {
+				atomic.AddInt64(ran, 1)
+
+				if i < together {
+					started.Done()
+					started.Wait()
+				}
+
+				next := []job{}
+				for c := 0; c < children; c++ {
+					next = append(next, job{
+						name: "child",
+						run: func() jobResult {
+							atomic.AddInt64(ran, 1)
+							return jobResult{}
+						},
+					})
+				}
+
+				return jobResult{next: next}
+			},
+		})
+	}
+
+	return queue
+}
+
+func TestRunJobs(t *testing.T) {
+	var ran int64
+	runJobs(context.Background(), makeQueueingJobs(5, 3, 0, &ran), 2, func(jobResult) bool { return true })
+
+	if ran != 20 {
+		t.Errorf("ran %d jobs, want 20", ran)
+	}
+}
+
+func TestRunJobsStopsWhenCollectSaysSo(t *testing.T) {
+	var ran int64
+	collected := 0
+
+	runJobs(context.Background(), makeQueueingJobs(5, 3, 2, &ran), 2, func(jobResult) bool {
+		collected++
+		return collected > 1
+	})
+
+	// Both workers were busy when the first job said to stop. What either of
+	// them queued is dropped and nothing else runs, even though the second
+	// result doesn't say to stop.
+	if ran != 2 || collected != 2 {
+		t.Errorf("ran %d jobs and collected %d, want 2 and 2", ran, collected)
+	}
+}
+
+func TestRunJobsStopsWhenCancelled(t *testing.T) {
+	var ran int64
+	ctx, cancel := context.WithCancel(context.Background())
+
+	runJobs(ctx, makeQueueingJobs(5, 3, 2, &ran), 2, func(jobResult) bool {
+		cancel()
+		return true
+	})
+
+	if ran != 2 {
+		t.Errorf("ran %d jobs after cancelling, want 2", ran)
+	}
+}
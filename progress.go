@@ -0,0 +1,119 @@
+package bock
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reports progress through a batch of jobs. This is the only thing that should
+// print while workers are running. On a terminal it's a single bar that redraws
+// itself in place. Anywhere else (like CI logs) it's a plain line every
+// progressLogJobs jobs or progressLogInterval, and one at the end.
+type progress struct {
+	label string
+	total int
+	done  int
+	out   io.Writer
+	isTTY bool
+	mutex sync.Mutex
+
+	// When we last printed a line, and how many jobs were done then
+	loggedAt   time.Time
+	loggedDone int
+}
+
+func newProgress(label string, total int, out io.Writer) *progress {
+	f, isFile := out.(*os.File)
+
+	return &progress{
+		label:    label,
+		total:    total,
+		out:      out,
+		isTTY:    isFile && isTerminal(f),
+		loggedAt: time.Now(),
+	}
+}
+
+// Jobs can queue more jobs so the total can grow as we go
+func (p *progress) expect(count int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.total += count
+}
+
+func (p *progress) report(result jobResult) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.done += 1
+
+	for _, w := range result.warnings {
+		p.log("WARN: " + result.name + ": " + w)
+	}
+
+	if result.err != nil {
+		p.log("ERROR: " + result.name + ": " + result.err.Error())
+	}
+
+	if p.isTTY {
+		p.draw(result.name)
+	} else if p.done-p.loggedDone >= progressLogJobs || time.Since(p.loggedAt) >= progressLogInterval {
+		p.summarize()
+	}
+}
+
+// Clear the bar and leave the cursor at the start of an empty line
+func (p *progress) finish() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.isTTY {
+		fmt.Fprint(p.out, "\033[2K\r")
+	} else if p.done > p.loggedDone {
+		p.summarize()
+	}
+}
+
+// Expects the mutex to be held
+func (p *progress) summarize() {
+	fmt.Fprintf(p.out, "%s: %d/%d\n", p.label, p.done, p.total)
+
+	p.loggedAt = time.Now()
+	p.loggedDone = p.done
+}
+
+// Print a line without mangling the bar. Expects the mutex to be held.
+func (p *progress) log(line string) {
+	if p.isTTY {
+		fmt.Fprint(p.out, "\033[2K\r")
+	}
+
+	fmt.Fprintln(p.out, line)
+}
+
+// Expects the mutex to be held
+func (p *progress) draw(name string) {
+	filled := 0
+	if p.total > 0 {
+		filled = progressBarWidth * p.done / p.total
+	}
+
+	if runes := []rune(name); len(runes) > progressNameWidth {
+		name = "…" + string(runes[len(runes)-progressNameWidth+1:])
+	}
+
+	fmt.Fprintf(p.out,
+		"\033[2K\r%s [%s%s] %d/%d %s",
+		p.label,
+		strings.Repeat("#", filled),
+		strings.Repeat(" ", progressBarWidth-filled),
+		p.done,
+		p.total,
+		name,
+	)
+}
@@ -1,8 +1,8 @@
-package main
+package bock
 
 import (
 	"bytes"
-	"embed"
+	"fmt"
 
 	"github.com/flosch/pongo2/v5"
 
@@ -12,11 +12,17 @@ import (
 	"github.com/yuin/goldmark"
 	highlighting "github.com/yuin/goldmark-highlighting"
 	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
 )
 
 // We use Goldmark as the Markdown converter. Configure it here.
 var markdown = goldmark.New(
+	goldmark.WithParserOptions(
+		parser.WithAutoHeadingID(),
+		parser.WithHeadingAttribute(),
+	),
 	goldmark.WithRendererOptions(
 		html.WithXHTML(),
 		html.WithUnsafe(),
@@ -35,13 +41,33 @@ var markdown = goldmark.New(
 			),
 		),
 		mathjax.MathJax,
+		wikiLinkExtension,
 	),
 )
 
-//go:embed template
-var templatesContent embed.FS
-var pongoLoader = pongo2.NewFSLoader(templatesContent)
-var templateSet = pongo2.NewSet("template", pongoLoader)
+// Make a parser context for one article. Wiki links are resolved against
+// `index` (which can be nil) and headings get their IDs.
+func newMarkdownContext(index *wikiLinkIndex) (parser.Context, *wikiLinkContext) {
+	ctx := &wikiLinkContext{index: index}
+
+	pc := parser.NewContext(parser.WithIDs(newHeadingIDs()))
+	pc.Set(wikiLinkContextKey, ctx)
+
+	return pc, ctx
+}
+
+// Convert Markdown to HTML, resolving wiki links against `index` (which can be
+// nil). Returns the HTML, every heading in it, and the targets of the links
+// that didn't resolve.
+func convertMarkdown(source []byte, index *wikiLinkIndex) (string, []tocEntry, []string, error) {
+	var buffer bytes.Buffer
+
+	pc, ctx := newMarkdownContext(index)
+	document := markdown.Parser().Parse(text.NewReader(source), parser.WithContext(pc))
+	err := markdown.Renderer().Render(&buffer, source, document)
+
+	return buffer.String(), makeHeadings(document, source), ctx.missing, err
+}
 
 // Register some Pongo filters
 // TODO: How do I prevent this assignment?
@@ -51,162 +77,237 @@ var _ = pongo2.RegisterFilter(
 		return pongo2.AsValue(humanize.Comma(int64(in.Integer()))), nil
 	})
 
-var t_archive, _ = templateSet.FromCache("template/archive.njk")
-var t_article, _ = templateSet.FromCache("template/article.njk")
-var t_folder, _ = templateSet.FromCache("template/folder.njk")
-var t_index, _ = templateSet.FromCache("template/index.njk")
-var t_not_found, _ = templateSet.FromCache("template/not-found.njk")
-var t_random, _ = templateSet.FromCache("template/random.njk")
-var t_revision_raw, _ = templateSet.FromCache("template/revision-raw.njk")
-var t_revision, _ = templateSet.FromCache("template/revision.njk")
-var t_revisionList, _ = templateSet.FromCache("template/revision-list.njk")
-
-func renderIndex(config *BockConfig) string {
-	html, _ := t_index.Execute(pongo2.Context{
-		"type":    "index",
-		"version": VERSION,
+var _ = pongo2.RegisterFilter(
+	"tagURI",
+	func(in *pongo2.Value, param *pongo2.Value) (*pongo2.Value, *pongo2.Error) {
+		return pongo2.AsValue(makeTagURI(in.String())), nil
 	})
 
-	return html
+func renderIndex(config *bockConfig) (string, error) {
+	return config.compiled.execute("index", pongo2.Context{
+		"meta":    config.meta,
+		"type":    "index",
+		"version": version,
+	})
 }
 
-func renderNotFound(config *BockConfig) string {
-	html, _ := t_not_found.Execute(pongo2.Context{
+func renderNotFound(config *bockConfig) (string, error) {
+	return config.compiled.execute("not-found", pongo2.Context{
+		"meta":    config.meta,
 		"type":    "not-found",
-		"version": VERSION,
+		"version": version,
 	})
-
-	return html
 }
 
-func renderRandom(config *BockConfig) string {
-	html, _ := t_random.Execute(pongo2.Context{
+func renderRandom(config *bockConfig) (string, error) {
+	return config.compiled.execute("random", pongo2.Context{
 		"list":    config.listOfArticles,
+		"meta":    config.meta,
 		"type":    "random",
-		"version": VERSION,
+		"version": version,
 	})
+}
 
-	return html
+func renderRecentChanges(changes []change, config *bockConfig) (string, error) {
+	return config.compiled.execute("recent", pongo2.Context{
+		"changes": changes,
+		"title":   "Recent Changes",
+		"uri":     "/recent",
+
+		"meta":    config.meta,
+		"type":    "recent",
+		"version": version,
+	})
 }
 
+// Fills in the article's HTML and table of contents. Returns any wiki links in
+// it that don't lead anywhere.
 func renderArticle(
 	source []byte,
-	article Article,
+	article *article,
 	entityType string,
-	config *BockConfig,
-) (string, string) {
-	var conversionBuffer bytes.Buffer
-	if err := markdown.Convert(source, &conversionBuffer); err != nil {
-		panic(err)
+	config *bockConfig,
+) ([]string, error) {
+	articleHTML, headings, missingLinks, err := convertMarkdown(source, config.wikiLinks)
+	if err != nil {
+		return nil, fmt.Errorf("could not convert the Markdown: %w", err)
 	}
 
+	toc := makeTOC(headings, article.tocDepth)
+
 	baseContext := pongo2.Context{
+		"aliases":      article.Aliases,
+		"backlinks":    article.Backlinks,
 		"created":      article.Created,
+		"date":         article.Date,
+		"description":  article.Description,
+		"draft":        article.Draft,
 		"hierarchy":    article.Hierarchy,
-		"html":         conversionBuffer.String(),
+		"html":         articleHTML,
 		"id":           article.ID,
 		"modified":     article.Modified,
 		"revisions":    article.Revisions,
 		"sizeInBytes":  article.Size,
 		"source":       article.Source,
+		"tags":         article.Tags,
 		"title":        article.Title,
+		"toc":          toc,
 		"untracked":    article.Untracked,
 		"uri":          article.URI,
 		"relativePath": article.RelativePath,
+		"editURL":      makeEditURL(article.RelativePath, config),
 
 		"meta":    config.meta,
 		"type":    entityType,
-		"version": VERSION,
+		"version": version,
 	}
 
-	html, _ := t_article.Execute(baseContext)
-
-	baseContext.Update(pongo2.Context{
-		"type": "raw",
-	})
-
-	raw := article.Source
+	html, err := config.compiled.execute("article", baseContext)
+	if err != nil {
+		return nil, err
+	}
 
-	conversionBuffer.Reset()
+	article.Html = html
+	article.TOC = toc
+	article.headings = headings
 
-	return html, raw
+	return missingLinks, nil
 }
 
-func renderFolder(folder Folder) string {
-	var conversionBuffer bytes.Buffer
-	if err := markdown.Convert([]byte(folder.README), &conversionBuffer); err != nil {
-		panic(err)
+func renderFolder(folder folder, config *bockConfig) (string, error) {
+	readme, _, _, err := convertMarkdown([]byte(folder.README), config.wikiLinks)
+	if err != nil {
+		return "", fmt.Errorf("could not convert the README: %w", err)
 	}
 
-	html, _ := t_folder.Execute(pongo2.Context{
+	return config.compiled.execute("folder", pongo2.Context{
 		"children":  folder.Children,
 		"hierarchy": folder.Hierarchy,
-		"readme":    conversionBuffer.String(),
+		"readme":    readme,
 		"title":     folder.Title,
 		"uri":       folder.URI,
 
+		"meta":    config.meta,
 		"type":    "folder",
-		"version": VERSION,
+		"version": version,
 	})
-
-	conversionBuffer.Reset()
-
-	return html
 }
 
-func renderArchive(config *BockConfig) string {
-	html, _ := t_archive.Execute(pongo2.Context{
+func renderArchive(config *bockConfig) (string, error) {
+	return config.compiled.execute("archive", pongo2.Context{
 		"title": "Archive",
 		"tree":  config.entityTree,
 		"uri":   "/archive",
 
 		"meta":    config.meta,
 		"type":    "archive",
-		"version": VERSION,
+		"version": version,
 	})
+}
+
+func renderTagList(config *bockConfig) (string, error) {
+	return config.compiled.execute("tag-list", pongo2.Context{
+		"tags":  config.listOfTags,
+		"title": "Tags",
+		"uri":   "/tags",
 
-	return html
+		"meta":    config.meta,
+		"type":    "tag-list",
+		"version": version,
+	})
 }
 
-func renderRevisionList(article Article, revisions []Revision) string {
-	html, _ := t_revisionList.Execute(pongo2.Context{
-		"revisions": revisions,
-		"hierarchy": article.Hierarchy,
-		"title":     article.Title,
-		"uri":       article.URI,
+func renderTag(tag tag, config *bockConfig) (string, error) {
+	return config.compiled.execute("tag", pongo2.Context{
+		"articles": tag.Articles,
+		"tag":      tag.Name,
+		"title":    tag.Name,
+		"uri":      tag.URI,
 
-		"type":    "revision-list",
-		"version": VERSION,
+		"meta":    config.meta,
+		"type":    "tag",
+		"version": version,
 	})
+}
+
+func renderRevisionList(article article, revisions []revision, config *bockConfig) (string, error) {
+	return config.compiled.execute("revision-list", pongo2.Context{
+		"revisions":    revisions,
+		"hierarchy":    article.Hierarchy,
+		"relativePath": article.RelativePath,
+		"title":        article.Title,
+		"uri":          article.URI,
 
-	return html
+		"meta":    config.meta,
+		"type":    "revision-list",
+		"version": version,
+	})
 }
 
-func renderRevision(article Article, revision Revision) (string, string) {
-	var conversionBuffer bytes.Buffer
-	if err := markdown.Convert([]byte(revision.Content), &conversionBuffer); err != nil {
-		panic(err)
+func renderRevision(article article, revision revision, config *bockConfig) (string, string, error) {
+	_, body, _ := parseFrontmatter([]byte(revision.Content))
+
+	// Old revisions link to whatever existed back then so wiki links aren't
+	// checked against the articles we have now
+	revisionHTML, _, _, err := convertMarkdown(body, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("could not convert the Markdown: %w", err)
 	}
 
 	baseContext := pongo2.Context{
-		"html":      conversionBuffer.String(),
-		"hierarchy": article.Hierarchy,
-		"revision":  revision,
-		"source":    revision.Content,
-		"title":     article.Title,
-		"uri":       article.URI,
+		"html":         revisionHTML,
+		"hierarchy":    article.Hierarchy,
+		"relativePath": article.RelativePath,
+		"revision":     revision,
+		"source":       revision.Content,
+		"title":        article.Title,
+		"uri":          article.URI,
 
+		"meta":    config.meta,
 		"type":    "revision",
-		"version": VERSION,
+		"version": version,
+	}
+	html, err := config.compiled.execute("revision", baseContext)
+	if err != nil {
+		return "", "", err
 	}
-	html, _ := t_revision.Execute(baseContext)
 
 	baseContext.Update(pongo2.Context{
 		"type": "revision-raw",
 	})
-	raw, _ := t_revision_raw.Execute(baseContext)
 
-	conversionBuffer.Reset()
+	raw, err := config.compiled.execute("revision-raw", baseContext)
+
+	return html, raw, err
+}
+
+func renderRevisionDiff(article article, revision revision, previous revision, diff diff, config *bockConfig) (string, error) {
+	return config.compiled.execute("revision-diff", pongo2.Context{
+		"diff":      diff,
+		"hierarchy": article.Hierarchy,
+		"previous":  previous,
+		"revision":  revision,
+		"title":     article.Title,
+		"uri":       article.URI,
 
-	return html, raw
+		"meta":    config.meta,
+		"type":    "revision-diff",
+		"version": version,
+	})
+}
+
+// The comparison page does its diffing in the browser since we can't generate
+// a page for every pair of revisions. It fetches the two being compared from
+// `revisions/<short ID>.json` (see `writeRevision`).
+func renderRevisionCompare(article article, revisions []revision, config *bockConfig) (string, error) {
+	return config.compiled.execute("revision-compare", pongo2.Context{
+		"hierarchy": article.Hierarchy,
+		"revisions": revisions,
+		"title":     article.Title,
+		"uri":       article.URI,
+
+		"meta":    config.meta,
+		"type":    "revision-compare",
+		"version": version,
+	})
 }
@@ -0,0 +1,327 @@
+package bock
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// `bock serve` searches the wiki itself at searchAPIPath so pages don't have
+// to download all of `articles.db` first. These are the same queries that
+// `search.js` runs with sql.js (which it still does on static hosting) and they
+// return the same rows. Matches are marked with `>>>` and `<<<`.
+
+type searchResult struct {
+	URI              string `json:"uri"`
+	Title            string `json:"title"`
+	HighlightedTitle string `json:"highlightedTitle"`
+	Content          string `json:"content"`
+
+	// When and why this was changed, if it's an old revision
+	Revision string `json:"revision,omitempty"`
+}
+
+// Words like `#linux` (or `#Open_BSD`) narrow results down to articles with
+// that tag. Everything else is the search term.
+func parseSearch(q string) (string, []string) {
+	terms := []string{}
+	tags := []string{}
+
+	for _, word := range strings.Fields(q) {
+		if !strings.HasPrefix(word, "#") {
+			terms = append(terms, word)
+		} else if len(word) > 1 {
+			tags = append(tags, strings.ReplaceAll(word[1:], "_", " "))
+		}
+	}
+
+	return strings.Join(terms, " "), tags
+}
+
+func searchTagFilter(column string, tags []string) string {
+	filters := make([]string, len(tags))
+
+	for i := range tags {
+		filters[i] = column + " IN (SELECT article_id FROM tags WHERE tag = ? COLLATE NOCASE)"
+	}
+
+	return strings.Join(filters, " AND ")
+}
+
+func querySearch(db *sql.DB, query string, args ...interface{}) ([]searchResult, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	results := []searchResult{}
+
+	for rows.Next() {
+		var r searchResult
+		if err := rows.Scan(&r.URI, &r.Title, &r.HighlightedTitle, &r.Content); err != nil {
+			return nil, err
+		}
+
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
+
+// Search articles by their titles and contents, then the headings in them
+func searchArticles(db *sql.DB, term string, tags []string) ([]searchResult, error) {
+	args := []interface{}{fmt.Sprintf("title:%s* OR content:%s*", term, term)}
+	for _, t := range tags {
+		args = append(args, t)
+	}
+
+	filter := ""
+	if len(tags) > 0 {
+		filter = "AND " + searchTagFilter("id", tags)
+	}
+
+	articles, err := querySearch(db, `
+    SELECT
+      uri,
+      title,
+      highlight(articles_fts, 3, '>>>', '<<<') as highlightedTitle,
+      snippet(articles_fts, 1, '>>>', '<<<', '...', 50) as content
+    FROM articles_fts
+    WHERE articles_fts MATCH ?
+    `+filter+`
+    ORDER BY RANK
+    LIMIT 100
+  `, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	args[0] = fmt.Sprintf("title:%s*", term)
+
+	filter = ""
+	if len(tags) > 0 {
+		filter = "AND " + searchTagFilter("h.article_id", tags)
+	}
+
+	headings, err := querySearch(db, `
+    SELECT
+      a.uri || '#' || h.anchor as uri,
+      a.title || ' § ' || h.title as title,
+      a.title || ' § ' || highlight(headings_fts, 2, '>>>', '<<<') as highlightedTitle,
+      '' as content
+    FROM headings_fts
+    JOIN headings h ON h.rowid = headings_fts.rowid
+    JOIN articles a ON a.id = h.article_id
+    WHERE headings_fts MATCH ?
+    `+filter+`
+    ORDER BY RANK
+    LIMIT 20
+  `, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(articles, headings...), nil
+}
+
+// Old revisions that have the term. Only the newest one for each article is
+// returned so an article with a hundred revisions doesn't drown out everything
+// else.
+func searchHistory(db *sql.DB, term string, tags []string) ([]searchResult, error) {
+	args := []interface{}{fmt.Sprintf("content:%s* OR subject:%s*", term, term)}
+	for _, t := range tags {
+		args = append(args, t)
+	}
+
+	filter := ""
+	if len(tags) > 0 {
+		filter = "AND " + searchTagFilter("r.article_id", tags)
+	}
+
+	rows, err := db.Query(`
+    SELECT
+      a.uri || '/revisions/' || r.short_id as uri,
+      a.title as title,
+      a.title as highlightedTitle,
+      snippet(revisions_fts, 1, '>>>', '<<<', '...', 50) as content,
+      r.article_id as articleId,
+      'As of ' || substr(r.date, 1, 10) || ': ' || r.subject as revision
+    FROM revisions_fts
+    JOIN revisions r ON r.rowid = revisions_fts.rowid
+    JOIN articles a ON a.id = r.article_id
+    WHERE revisions_fts MATCH ?
+    `+filter+`
+    ORDER BY r.date DESC
+    LIMIT 1000
+  `, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	results := []searchResult{}
+	seen := map[string]bool{}
+
+	for rows.Next() && len(results) < 100 {
+		var r searchResult
+		var articleID string
+
+		if err := rows.Scan(&r.URI, &r.Title, &r.HighlightedTitle, &r.Content, &articleID, &r.Revision); err != nil {
+			return nil, err
+		}
+
+		if !seen[articleID] {
+			seen[articleID] = true
+			results = append(results, r)
+		}
+	}
+
+	return results, rows.Err()
+}
+
+// Articles with every one of the tags
+func searchTags(db *sql.DB, tags []string) ([]searchResult, error) {
+	args := []interface{}{}
+	for _, t := range tags {
+		args = append(args, t)
+	}
+
+	return querySearch(db, `
+    SELECT
+      uri,
+      title,
+      title as highlightedTitle,
+      COALESCE(description, '') as content
+    FROM articles
+    WHERE `+searchTagFilter("id", tags)+`
+    ORDER BY title COLLATE NOCASE
+  `, args...)
+}
+
+// Search the wiki the way the archive page does. Searching with neither a term
+// nor tags finds nothing.
+func search(db *sql.DB, q string, withHistory bool) ([]searchResult, error) {
+	term, tags := parseSearch(q)
+
+	switch {
+	case term != "":
+		results, err := searchArticles(db, term, tags)
+		if err != nil || !withHistory {
+			return results, err
+		}
+
+		history, err := searchHistory(db, term, tags)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(results, history...), nil
+
+	case len(tags) > 0:
+		return searchTags(db, tags)
+	}
+
+	return []searchResult{}, nil
+}
+
+// A copy of `articles.db` from the last build. Searches use it while the next
+// build updates the real one, which might not even be on disk.
+type searchIndex struct {
+	mutex sync.RWMutex
+	db    *sql.DB
+	file  string
+}
+
+// Copy the database from the output again after a build
+func (s *searchIndex) refresh(output Output, name string) error {
+	contents, err := fs.ReadFile(output, name)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp("", "bock-search-*.db")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(contents)
+	f.Close()
+
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	db, err := sql.Open(sqliteDriver, f.Name())
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	s.mutex.Lock()
+	previousDB, previousFile := s.db, s.file
+	s.db, s.file = db, f.Name()
+	s.mutex.Unlock()
+
+	if previousDB != nil {
+		previousDB.Close()
+		os.Remove(previousFile)
+	}
+
+	return nil
+}
+
+func (s *searchIndex) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.db != nil {
+		s.db.Close()
+		os.Remove(s.file)
+		s.db = nil
+	}
+}
+
+// `?q=` is what was typed into the search box. `&history=true` searches old
+// revisions too.
+func (s *searchIndex) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	respond := func(status int, body interface{}) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+
+	if s.db == nil {
+		respond(http.StatusServiceUnavailable, map[string]string{"error": "the wiki hasn't been built yet"})
+		return
+	}
+
+	q := r.URL.Query().Get("q")
+	withHistory, _ := strconv.ParseBool(r.URL.Query().Get("history"))
+
+	// Almost always a term that isn't valid FTS5 syntax, like one with quotes
+	results, err := search(s.db, q, withHistory)
+	if err != nil {
+		respond(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	respond(http.StatusOK, map[string]interface{}{
+		"query":   q,
+		"results": results,
+	})
+}
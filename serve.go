@@ -0,0 +1,292 @@
+package bock
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// `bock serve` builds the wiki, serves it, and rebuilds it whenever something
+// changes. Rebuilds use the build manifest so only what changed is written
+// again. Every HTML page gets a small script that reloads it once a rebuild is
+// done.
+
+const liveReloadScript = `<script>new EventSource("` + liveReloadPath + `").onmessage = () => location.reload();</script>`
+
+// Keeps track of open pages and tells them to reload with Server-Sent Events
+type reloadHub struct {
+	mutex   sync.Mutex
+	clients map[chan bool]bool
+}
+
+func (h *reloadHub) broadcast() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for c := range h.clients {
+		// Don't wait on pages that haven't read the last reload yet
+		select {
+		case c <- true:
+		default:
+		}
+	}
+}
+
+func (h *reloadHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	c := make(chan bool, 1)
+
+	h.mutex.Lock()
+	h.clients[c] = true
+	h.mutex.Unlock()
+
+	defer func() {
+		h.mutex.Lock()
+		delete(h.clients, c)
+		h.mutex.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-c:
+			fmt.Fprint(w, "data: reload\n\n")
+			flusher.Flush()
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Serve the output folder the way the wiki expects to be served: `/Foo` is
+// `/Foo/index.html` and anything that doesn't exist gets the 404 page.
+func makeOutputHandler(output Output) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		status := http.StatusOK
+
+		if name == "" {
+			name = "."
+		}
+
+		if info, err := fs.Stat(output, name); err == nil && info.IsDir() {
+			name = path.Join(name, "index.html")
+		}
+
+		info, err := fs.Stat(output, name)
+		if err != nil {
+			name = "404.html"
+			status = http.StatusNotFound
+		}
+
+		contents, err := fs.ReadFile(output, name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if path.Ext(name) != ".html" {
+			http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(contents))
+			return
+		}
+
+		page := string(contents)
+		if i := strings.LastIndex(page, "</body>"); i != -1 {
+			page = page[:i] + liveReloadScript + page[i:]
+		} else {
+			page += liveReloadScript
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		fmt.Fprint(w, page)
+	})
+}
+
+// The modification time and size of every article, asset, and template. Two
+// different snapshots mean something changed and we should rebuild.
+func snapshotSources(options Options) map[string]string {
+	snapshot := make(map[string]string)
+
+	filepath.WalkDir(options.ArticleRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if d.IsDir() {
+			if p != options.ArticleRoot && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules") {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		relativePath := makeRelativePath(p, options.ArticleRoot)
+		if filepath.Ext(p) != ".md" && !strings.HasPrefix(relativePath, "__assets/") {
+			return nil
+		}
+
+		if info, err := d.Info(); err == nil {
+			snapshot[p] = fmt.Sprint(info.ModTime().UnixNano(), info.Size())
+		}
+
+		return nil
+	})
+
+	if options.TemplateFolder != "" {
+		filepath.WalkDir(options.TemplateFolder, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+
+			if info, err := d.Info(); err == nil {
+				snapshot[p] = fmt.Sprint(info.ModTime().UnixNano(), info.Size())
+			}
+
+			return nil
+		})
+	}
+
+	return snapshot
+}
+
+func sameSnapshots(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Build the wiki once, for Serve, and search what we built. Whatever goes
+// wrong is printed and we keep serving what we have.
+func buildForServe(ctx context.Context, options Options, index *searchIndex) {
+	result, err := Build(ctx, options)
+	if ctx.Err() != nil {
+		return
+	}
+
+	if err != nil {
+		for _, problem := range result.Problems {
+			fmt.Fprintln(options.Log, problem)
+		}
+
+		fmt.Fprintln(options.Log, "ERROR:", err)
+	}
+
+	if err := index.refresh(options.Output, databaseName(options.SearchIndex)); err != nil {
+		fmt.Fprintln(options.Log, "ERROR: could not search the wiki:", err)
+	}
+}
+
+// Build the wiki, serve it on localhost, and rebuild it whenever an article,
+// asset, or template changes until the context is cancelled. The wiki is built
+// in memory if there's no OutputFolder or Output.
+func Serve(ctx context.Context, options Options, port int) error {
+	options = options.withDefaults()
+
+	where := options.OutputFolder
+
+	switch {
+	case options.Output != nil:
+		where = "the wiki"
+
+	case options.OutputFolder == "":
+		options.Output = NewMemoryOutput()
+		where = "the wiki from memory"
+
+	default:
+		options.Output = NewDirOutput(options.OutputFolder)
+	}
+
+	if options.BaseURL == "" {
+		options.BaseURL = fmt.Sprintf("http://localhost:%d", port)
+	}
+
+	index := &searchIndex{}
+	defer index.close()
+
+	snapshot := snapshotSources(options)
+	buildForServe(ctx, options, index)
+
+	hub := &reloadHub{clients: make(map[chan bool]bool)}
+
+	mux := http.NewServeMux()
+	mux.Handle(liveReloadPath, hub)
+	mux.Handle(searchAPIPath, index)
+	mux.Handle("/", makeOutputHandler(options.Output))
+
+	// Requests share our context so open pages let go when we stop
+	server := &http.Server{
+		Addr:        fmt.Sprintf("localhost:%d", port),
+		Handler:     mux,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	// Look for changes and rebuild. Builds happen one at a time, here.
+	go func() {
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case <-ticker.C:
+				latest := snapshotSources(options)
+				if sameSnapshots(snapshot, latest) {
+					continue
+				}
+
+				snapshot = latest
+
+				fmt.Fprintln(options.Log, "\nSomething changed. Rebuilding...")
+				buildForServe(ctx, options, index)
+				hub.broadcast()
+			}
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		server.Shutdown(shutdown)
+	}()
+
+	fmt.Fprintf(options.Log, "\nServing %s at http://%s (Ctrl+C to stop)\n", where, server.Addr)
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("could not serve the wiki: %w", err)
+	}
+
+	return nil
+}
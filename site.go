@@ -0,0 +1,125 @@
+package bock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// What you get without a site config
+func DefaultSiteConfig() SiteConfig {
+	return SiteConfig{
+		Title:   "Wiki",
+		Home:    "Home",
+		HomeURI: makeHomeURI("Home"),
+		MathJax: true,
+		TOC:     3,
+	}
+}
+
+// Read the site config. A missing file is fine unless you asked for it with
+// `--config` (`required`); you get the defaults. Anything you leave out of the
+// file also gets its default.
+func ReadSiteConfig(configPath string, required bool) (SiteConfig, error) {
+	contents, err := os.ReadFile(configPath)
+	if err != nil {
+		if !required && errors.Is(err, os.ErrNotExist) {
+			return DefaultSiteConfig(), nil
+		}
+
+		return DefaultSiteConfig(), err
+	}
+
+	return parseSiteConfig(contents, configPath)
+}
+
+// The same as ReadSiteConfig but from a file in `fsys`, like a GitTreeFS
+func ReadSiteConfigFS(fsys fs.FS, name string, required bool) (SiteConfig, error) {
+	contents, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		if !required && errors.Is(err, fs.ErrNotExist) {
+			return DefaultSiteConfig(), nil
+		}
+
+		return DefaultSiteConfig(), err
+	}
+
+	return parseSiteConfig(contents, name)
+}
+
+func parseSiteConfig(contents []byte, configPath string) (SiteConfig, error) {
+	site := DefaultSiteConfig()
+
+	// Catch typos like `tilte`
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(&site); err != nil && err != io.EOF {
+		return site, fmt.Errorf("could not read %s: %w", configPath, err)
+	}
+
+	site.BaseURL = strings.TrimRight(site.BaseURL, "/")
+	site.Home = strings.TrimSuffix(strings.Trim(site.Home, "/"), ".md")
+
+	if site.Home == "" {
+		return site, fmt.Errorf("'home' in %s can't be empty", configPath)
+	}
+
+	site.HomeURI = makeHomeURI(site.Home)
+
+	for _, pattern := range site.Ignore {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return site, fmt.Errorf("'%s' in %s is not a valid pattern", pattern, configPath)
+		}
+	}
+
+	return site, nil
+}
+
+// Simplified just like any other article's URI
+func makeHomeURI(home string) string {
+	return "/" + strings.ReplaceAll(home, " ", "_")
+}
+
+// Where to edit an article, if the site config says so
+func makeEditURL(relativePath string, config *bockConfig) string {
+	if config.site.EditURL == "" {
+		return ""
+	}
+
+	fragments := strings.Split(relativePath, "/")
+	for i, f := range fragments {
+		fragments[i] = url.PathEscape(f)
+	}
+
+	return strings.ReplaceAll(config.site.EditURL, "{path}", strings.Join(fragments, "/"))
+}
+
+// Whether the site config says to leave an article out. Patterns are matched
+// against the article's path, every folder it's in, and each of their names.
+// So `drafts` leaves out everything in any folder called `drafts`.
+func isIgnored(relativePath string, config *bockConfig) bool {
+	fragments := strings.Split(relativePath, "/")
+
+	for _, pattern := range config.site.Ignore {
+		for i := range fragments {
+			if m, _ := path.Match(pattern, strings.Join(fragments[:i+1], "/")); m {
+				return true
+			}
+
+			if m, _ := path.Match(pattern, fragments[i]); m {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,36 @@
+package bock
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSiteConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		mathJax bool
+		head    []string
+	}{
+		{"empty", "", true, nil},
+		{"extra head", "head:\n  - <script src=\"/a.js\"></script>\n", true, []string{`<script src="/a.js"></script>`}},
+		{"without MathJax", "mathjax: false\n", false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site, err := parseSiteConfig([]byte(tt.config), "bock.yaml")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if site.MathJax != tt.mathJax {
+				t.Errorf("got MathJax %v, want %v", site.MathJax, tt.mathJax)
+			}
+
+			if !reflect.DeepEqual(site.Head, tt.head) {
+				t.Errorf("got head %q, want %q", site.Head, tt.head)
+			}
+		})
+	}
+}
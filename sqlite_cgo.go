@@ -0,0 +1,11 @@
+//go:build !purego
+
+package bock
+
+// The default SQLite driver. It's fast but needs CGO (and the `fts5` build tag
+// for full-text search), which makes cross-compiling a pain. Build with the
+// `purego` tag to use the driver in `sqlite_purego.go` instead.
+
+import _ "github.com/mattn/go-sqlite3"
+
+const sqliteDriver = "sqlite3"
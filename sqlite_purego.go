@@ -0,0 +1,11 @@
+//go:build purego
+
+package bock
+
+// SQLite translated to Go. It's slower than the default driver but needs no
+// CGO, so static binaries for every platform can be built from one machine.
+// FTS5 is always there.
+
+import _ "modernc.org/sqlite"
+
+const sqliteDriver = "sqlite"
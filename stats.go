@@ -0,0 +1,154 @@
+package bock
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// What a build did and how long it took. Entities are written by many workers
+// at once so the counters here are atomic and the list of phases is behind a
+// mutex. Safe to use from any goroutine.
+type buildStats struct {
+	articles     atomic.Int64
+	folders      atomic.Int64
+	tags         atomic.Int64
+	revisions    atomic.Int64
+	filesWritten atomic.Int64
+	bytesWritten atomic.Int64
+	warnings     atomic.Int64
+	errors       atomic.Int64
+
+	mutex    sync.Mutex
+	phases   []PhaseTime
+	failures []BuildError
+}
+
+// Something that couldn't be built (an article, a folder, a page...) and why
+type BuildError struct {
+	Name string
+	Err  error
+}
+
+func (e BuildError) Error() string {
+	return e.Name + ": " + e.Err.Error()
+}
+
+func (e BuildError) Unwrap() error {
+	return e.Err
+}
+
+type PhaseTime struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Add up what a job did
+func (s *buildStats) collect(result jobResult) {
+	s.articles.Add(int64(result.articles))
+	s.folders.Add(int64(result.folders))
+	s.tags.Add(int64(result.tags))
+	s.revisions.Add(int64(result.revisions))
+	s.warnings.Add(int64(len(result.warnings)))
+
+	if result.err != nil {
+		s.fail(result.name, result.err)
+	}
+}
+
+// Note that something couldn't be built
+func (s *buildStats) fail(name string, err error) {
+	s.errors.Add(1)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.failures = append(s.failures, BuildError{Name: name, Err: err})
+}
+
+// Everything that couldn't be built, in the order it happened
+func (s *buildStats) failed() []BuildError {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]BuildError{}, s.failures...)
+}
+
+func (s *buildStats) wroteFile(size int) {
+	s.filesWritten.Add(1)
+	s.bytesWritten.Add(int64(size))
+}
+
+// Start timing a phase of the build. Call the function this returns when the
+// phase is done.
+func (s *buildStats) startPhase(name string) func() {
+	started := time.Now()
+
+	return func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		s.phases = append(s.phases, PhaseTime{
+			Name:     name,
+			Duration: time.Since(started),
+		})
+	}
+}
+
+// What the build did, for anyone using bock as a library
+func (s *buildStats) result(duration time.Duration) *Result {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return &Result{
+		Articles:     int(s.articles.Load()),
+		Folders:      int(s.folders.Load()),
+		Tags:         int(s.tags.Load()),
+		Revisions:    int(s.revisions.Load()),
+		FilesWritten: s.filesWritten.Load(),
+		BytesWritten: s.bytesWritten.Load(),
+		Warnings:     s.warnings.Load(),
+		Failures:     append([]BuildError{}, s.failures...),
+		Duration:     duration,
+		Phases:       append([]PhaseTime{}, s.phases...),
+	}
+}
+
+// A few lines about files written and where the time went
+func (s *buildStats) summary() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var b strings.Builder
+
+	fmt.Fprintf(
+		&b,
+		"Wrote %s files (%s)",
+		humanize.Comma(s.filesWritten.Load()),
+		humanize.Bytes(uint64(s.bytesWritten.Load())),
+	)
+
+	if w, e := s.warnings.Load(), s.errors.Load(); w > 0 || e > 0 {
+		fmt.Fprintf(&b, " with %d warnings and %d errors", w, e)
+	}
+
+	b.WriteString("\n")
+
+	for _, p := range s.phases {
+		fmt.Fprintf(&b, "  %-32s %s\n", p.Name, p.Duration.Round(time.Millisecond))
+	}
+
+	if len(s.failures) > 0 {
+		b.WriteString("\nCould not build:\n")
+
+		for _, f := range s.failures {
+			fmt.Fprintf(&b, "  %s\n", f)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,197 @@
+/**
+ * Compare any two revisions of an article. We can't generate a page for every
+ * pair so the diffing happens here. Only the two revisions being compared are
+ * downloaded (from `revisions/<short ID>.json`), and each one only once.
+ *
+ * This is the same diff as `makeDiff` in `diff.go` (which makes the generated
+ * diff pages) so the two always agree. Keep them in sync! Lines at the start
+ * and end that didn't change are skipped over and what's left between them is
+ * diffed with Myers' algorithm. Past MAX_EDITS changed lines, what's left is
+ * shown as deleted and then inserted wholesale.
+ */
+(() => {
+  const MAX_EDITS = 1000;
+
+  const form = document.querySelector(`[data-content="compare"]`);
+  const summary = document.querySelector(`[data-content="summary"]`);
+  const table = document.querySelector(`[data-content="diff"] tbody`);
+
+  const revisions = new Map();
+
+  const contentOf = (shortId) => {
+    if (!revisions.has(shortId)) {
+      revisions.set(
+        shortId,
+        fetch(`${form.dataset.revisions}/${shortId}.json`)
+          .then((res) => (res.ok ? res.json() : {}))
+          .then((revision) => revision.content || "")
+      );
+    }
+
+    return revisions.get(shortId);
+  };
+
+  const linesOf = (text) => {
+    const lines = text.split("\n");
+    return lines[lines.length - 1] === "" ? lines.slice(0, -1) : lines;
+  };
+
+  // Diff a[start:aEnd] against b[start:bEnd]. Line numbers carry on from
+  // `start`.
+  const diffMiddle = (a, b, start, aEnd, bEnd) => {
+    const n = aEnd - start;
+    const m = bEnd - start;
+    const lines = [];
+
+    const deleted = (x) => ({ type: "delete", text: a[start + x], old: start + x + 1, new: 0 });
+    const inserted = (y) => ({ type: "insert", text: b[start + y], old: 0, new: start + y + 1 });
+    const equal = (x, y) => ({ type: "equal", text: a[start + x], old: start + x + 1, new: start + y + 1 });
+
+    // How far along `a` the furthest path with `d` edits gets on each diagonal
+    // `k` (where k = x - y). `trace[d]` is that for diagonals -d to d.
+    const furthest = new Array(2 * (n + m) + 3).fill(0);
+    const offset = n + m + 1;
+    const trace = [];
+    let edits = -1;
+
+    for (let d = 0; d <= n + m && edits < 0; d++) {
+      if (d > MAX_EDITS) {
+        for (let x = 0; x < n; x++) {
+          lines.push(deleted(x));
+        }
+        for (let y = 0; y < m; y++) {
+          lines.push(inserted(y));
+        }
+
+        return lines;
+      }
+
+      for (let k = -d; k <= d; k += 2) {
+        let x =
+          k === -d || (k !== d && furthest[offset + k - 1] < furthest[offset + k + 1])
+            ? furthest[offset + k + 1]
+            : furthest[offset + k - 1] + 1;
+        let y = x - k;
+
+        while (x < n && y < m && a[start + x] === b[start + y]) {
+          x++;
+          y++;
+        }
+
+        furthest[offset + k] = x;
+
+        if (x >= n && y >= m) {
+          edits = d;
+          break;
+        }
+      }
+
+      trace.push(furthest.slice(offset - d, offset + d + 1));
+    }
+
+    // Walk back from the end to find which edits got us there
+    const reversed = [];
+    let x = n;
+    let y = m;
+
+    for (let d = edits; d > 0; d--) {
+      const previous = trace[d - 1];
+      const at = (k) => previous[k + d - 1];
+
+      const k = x - y;
+      const previousK = k === -d || (k !== d && at(k - 1) < at(k + 1)) ? k + 1 : k - 1;
+      const previousX = at(previousK);
+      const previousY = previousX - previousK;
+
+      while (x > previousX && y > previousY) {
+        x--;
+        y--;
+        reversed.push(equal(x, y));
+      }
+
+      reversed.push(previousK === k + 1 ? inserted(previousY) : deleted(previousX));
+
+      x = previousX;
+      y = previousY;
+    }
+
+    while (x > 0 && y > 0) {
+      x--;
+      y--;
+      reversed.push(equal(x, y));
+    }
+
+    return lines.concat(reversed.reverse());
+  };
+
+  const diff = (older, newer) => {
+    const a = linesOf(older);
+    const b = linesOf(newer);
+
+    let start = 0;
+    while (start < a.length && start < b.length && a[start] === b[start]) {
+      start++;
+    }
+
+    let aEnd = a.length;
+    let bEnd = b.length;
+    while (aEnd > start && bEnd > start && a[aEnd - 1] === b[bEnd - 1]) {
+      aEnd--;
+      bEnd--;
+    }
+
+    const equal = (i, j) => ({ type: "equal", text: a[i], old: i + 1, new: j + 1 });
+    let lines = [];
+
+    for (let i = 0; i < start; i++) {
+      lines.push(equal(i, i));
+    }
+
+    lines = lines.concat(diffMiddle(a, b, start, aEnd, bEnd));
+
+    for (let i = aEnd, j = bEnd; i < a.length; i++, j++) {
+      lines.push(equal(i, j));
+    }
+
+    return lines;
+  };
+
+  const escape = (text) =>
+    text.replace(/&/g, "&amp;").replace(/</g, "&lt;").replace(/>/g, "&gt;");
+
+  // Only the latest comparison that was asked for gets shown
+  let latest = 0;
+
+  const render = async () => {
+    const comparison = ++latest;
+    const [older, newer] = await Promise.all([
+      contentOf(form.from.value),
+      contentOf(form.to.value),
+    ]);
+
+    if (comparison !== latest) {
+      return;
+    }
+
+    const lines = diff(older, newer);
+    const tags = { insert: "ins", delete: "del", equal: "span" };
+
+    const insertions = lines.filter((l) => l.type === "insert").length;
+    const deletions = lines.filter((l) => l.type === "delete").length;
+    summary.innerHTML = `<ins>+${insertions}</ins> <del>-${deletions}</del>`;
+
+    table.innerHTML = lines
+      .map(
+        (l) => `
+      <tr data-diff="${l.type}">
+        <td>${l.old || ""}</td>
+        <td>${l.new || ""}</td>
+        <td><${tags[l.type]}>${escape(l.text)}</${tags[l.type]}></td>
+      </tr>`
+      )
+      .join("");
+  };
+
+  form.addEventListener("change", render);
+  render();
+})();
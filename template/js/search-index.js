@@ -0,0 +1,129 @@
+// Searches the prebuilt JSON index in `/search` (see `jsonindex.go` for what's
+// in it) for hosts that can't serve sql.js. Returns the same rows that
+// search.js gets from `articles.db`. Only the files for the words being
+// searched for are downloaded, and each one only once.
+const makeJSONSearch = async (base = "/search") => {
+  const index = await fetch(`${base}/index.json`).then((res) => {
+    if (!res.ok) {
+      throw new Error(`Could not load the search index: ${res.status}`);
+    }
+
+    return res.json();
+  });
+
+  const available = new Set(index.shards);
+  const shards = new Map();
+
+  // The same words the index was made with
+  const wordsIn = (text) =>
+    text
+      .toLowerCase()
+      .split(/[^\p{L}\p{N}]+/u)
+      .filter((w) => Array.from(w).length > 1);
+
+  const shardFor = (word) => {
+    const prefix = Array.from(word).slice(0, index.prefixLength).join("");
+
+    if (/^[a-z0-9]+$/.test(prefix)) {
+      return prefix;
+    }
+
+    const hex = Array.from(new TextEncoder().encode(prefix))
+      .map((b) => b.toString(16).padStart(2, "0"))
+      .join("");
+
+    return `_${hex}`;
+  };
+
+  const loadShard = (name) => {
+    if (!shards.has(name)) {
+      shards.set(
+        name,
+        available.has(name)
+          ? fetch(`${base}/${name}.json`).then((res) => res.json())
+          : Promise.resolve({})
+      );
+    }
+
+    return shards.get(name);
+  };
+
+  // Articles with a word that starts with `word`, and how well they match
+  const articlesWith = async (word) => {
+    const shard = await loadShard(shardFor(word));
+    const scores = new Map();
+
+    for (const [w, postings] of Object.entries(shard)) {
+      if (!w.startsWith(word)) {
+        continue;
+      }
+
+      for (const [article, score] of postings) {
+        scores.set(article, (scores.get(article) || 0) + score);
+      }
+    }
+
+    return scores;
+  };
+
+  // Mark whole words that start with what we searched for
+  const highlight = (text, words) =>
+    words.length === 0
+      ? text
+      : text.replace(
+          new RegExp(`(^|[^\\p{L}\\p{N}])((?:${words.join("|")})[\\p{L}\\p{N}]*)`, "giu"),
+          "$1>>>$2<<<"
+        );
+
+  // Every word has to match, like it does with SQLite. Tags work the same way
+  // they do there too.
+  return async (term, tags) => {
+    const words = wordsIn(term);
+    const wanted = tags.map((t) => t.toLowerCase());
+
+    let scores = null;
+
+    for (const word of words) {
+      const matches = await articlesWith(word);
+
+      if (scores === null) {
+        scores = matches;
+        continue;
+      }
+
+      for (const [article, score] of scores) {
+        if (matches.has(article)) {
+          scores.set(article, score + matches.get(article));
+        } else {
+          scores.delete(article);
+        }
+      }
+    }
+
+    if (scores === null) {
+      scores = new Map(index.articles.map((_, i) => [i, 0]));
+    }
+
+    return Array.from(scores)
+      .filter(([article]) => {
+        const articleTags = index.articles[article].tags.map((t) => t.toLowerCase());
+        return wanted.every((t) => articleTags.includes(t));
+      })
+      .sort(
+        ([a, aScore], [b, bScore]) =>
+          bScore - aScore ||
+          index.articles[a].title.localeCompare(index.articles[b].title)
+      )
+      .slice(0, 100)
+      .map(([article]) => {
+        const { uri, title, description } = index.articles[article];
+
+        return {
+          uri,
+          title,
+          highlightedTitle: highlight(title, words),
+          content: highlight(description, words),
+        };
+      });
+  };
+};
@@ -1,17 +1,47 @@
 const REMOTE_DATABASE = "/articles.db";
+const SEARCH_API = "/api/search";
+
+// Which search index the wiki was built with. Wikis built with `json` don't
+// have sql.js or `articles.db`, and `both` falls back to the JSON index if
+// sql.js can't be loaded.
+const SEARCH_INDEX =
+  (document.currentScript && document.currentScript.dataset.searchIndex) ||
+  "sqlite";
 
 (async () => {
-  config = {
-    locateFile: (filename) => `/js/${filename}`,
-  };
+  // `bock serve` searches the wiki for us. Everywhere else (like static
+  // hosting) we download the whole database and search it here with sql.js,
+  // or search the JSON index.
+  const searchRemotely = await fetch(`${SEARCH_API}?q=`)
+    .then(
+      (res) =>
+        res.ok &&
+        (res.headers.get("Content-Type") || "").startsWith("application/json")
+    )
+    .catch(() => false);
+
+  let db = null;
+  let searchJSON = null;
 
-  const sqlPromise = initSqlJs({
-    locateFile: (file) => `/js/${file}`,
-  });
+  if (!searchRemotely && SEARCH_INDEX !== "json") {
+    try {
+      const sqlPromise = initSqlJs({
+        locateFile: (file) => `/js/${file}`,
+      });
 
-  const dataPromise = fetch(REMOTE_DATABASE).then((res) => res.arrayBuffer());
-  const [SQL, buf] = await Promise.all([sqlPromise, dataPromise]);
-  const db = new SQL.Database(new Uint8Array(buf));
+      const dataPromise = fetch(REMOTE_DATABASE).then((res) => res.arrayBuffer());
+      const [SQL, buf] = await Promise.all([sqlPromise, dataPromise]);
+      db = new SQL.Database(new Uint8Array(buf));
+    } catch (e) {
+      if (SEARCH_INDEX !== "both") {
+        throw e;
+      }
+    }
+  }
+
+  if (!searchRemotely && !db) {
+    searchJSON = await makeJSONSearch();
+  }
 
   const renderer = nunjucks.configure({});
   renderer.addFilter("markMatch", (path) =>
@@ -25,6 +55,7 @@ const REMOTE_DATABASE = "/articles.db";
   {% for row in rows %}
   <li>
     <a href="{{ row.uri }}" title="{{ row.title }}">{{ row.highlightedTitle | arrowPath | markMatch | safe }}</a>
+    {% if row.revision %}<small>{{ row.revision }}</small>{% endif %}
     <span>
     {{ row.content | markMatch | safe }}
     </span>
@@ -32,17 +63,105 @@ const REMOTE_DATABASE = "/articles.db";
   {% endfor %}
   `;
 
+  const termInput = document.querySelector(`input[name="q"]`);
+  const historyInput = document.querySelector(`input[name="history"]`);
+
+  // The JSON index doesn't have old revisions in it
+  if (searchJSON && historyInput) {
+    historyInput.checked = false;
+    historyInput.closest("label").style.display = "none";
+  }
   const resultsSection = document.querySelector(`[data-content="results"]`);
   const treeSection = document.querySelector(`[data-content="tree"]`);
   const countSection = document.querySelector("h1");
   const oldCount = document.querySelector("h1").innerHTML;
 
-  document.querySelector("input").addEventListener("keyup", (e) => {
-    const term = e.target.value;
+  // Words like `#linux` (or `#Open_BSD`) narrow results down to articles with
+  // that tag. They can be used by themselves or along with a search term.
+  const tagFilter = (column, tags) =>
+    tags
+      .map(() => `${column} IN (SELECT article_id FROM tags WHERE tag = ? COLLATE NOCASE)`)
+      .join(" AND ");
+
+  const query = (sql, params) => {
+    const statement = db.prepare(sql);
+    statement.bind(params);
+
+    let rows = [];
+    while (statement.step()) {
+      rows.push(statement.getAsObject());
+    }
+
+    statement.free();
+
+    return rows;
+  };
+
+  // Old revisions that have the term. Only the newest one for each article is
+  // shown so an article with a hundred revisions doesn't drown out everything
+  // else.
+  const searchHistory = (term, tags) => {
+    const rows = query(
+      `
+      SELECT
+        a.uri || '/revisions/' || r.short_id as uri,
+        a.title as title,
+        a.title as highlightedTitle,
+        snippet(revisions_fts, 1, '>>>', '<<<', '...', 50) as content,
+        r.article_id as articleId,
+        'As of ' || substr(r.date, 1, 10) || ': ' || r.subject as revision
+      FROM revisions_fts
+      JOIN revisions r ON r.rowid = revisions_fts.rowid
+      JOIN articles a ON a.id = r.article_id
+      WHERE revisions_fts MATCH 'content:${term}* OR subject:${term}*'
+      ${tags.length > 0 ? "AND " + tagFilter("r.article_id", tags) : ""}
+      ORDER BY r.date DESC
+      LIMIT 1000
+      `,
+      tags
+    );
+
+    const seen = new Set();
+
+    return rows
+      .filter((row) => !seen.has(row.articleId) && seen.add(row.articleId))
+      .slice(0, 100);
+  };
+
+  // Sections whose headings have the term. These link straight to the heading.
+  const searchHeadings = (term, tags) =>
+    query(
+      `
+      SELECT
+        a.uri || '#' || h.anchor as uri,
+        a.title || ' § ' || h.title as title,
+        a.title || ' § ' || highlight(headings_fts, 2, '>>>', '<<<') as highlightedTitle,
+        '' as content
+      FROM headings_fts
+      JOIN headings h ON h.rowid = headings_fts.rowid
+      JOIN articles a ON a.id = h.article_id
+      WHERE headings_fts MATCH 'title:${term}*'
+      ${tags.length > 0 ? "AND " + tagFilter("h.article_id", tags) : ""}
+      ORDER BY RANK
+      LIMIT 20
+      `,
+      tags
+    );
+
+  // The same searches, on the server. It tells us when a term isn't valid
+  // FTS5 syntax and we show that as nothing found.
+  const searchServer = async (q, withHistory) => {
+    const params = new URLSearchParams({ q, history: withHistory });
+    const res = await fetch(`${SEARCH_API}?${params}`);
+
+    return res.ok ? (await res.json()).results : [];
+  };
 
-    if (term && term.length >= 3) {
+  const searchHere = (term, tags, withHistory) => {
+    if (term) {
       // https://sqlite.org/forum/info/00d53dbed15f5e5a
-      const thingSearchStatement = db.prepare(`
+      let rows = query(
+        `
       SELECT
         uri,
         title,
@@ -50,18 +169,72 @@ const REMOTE_DATABASE = "/articles.db";
         snippet(articles_fts, 1, '>>>', '<<<', '...', 50) as content
       FROM articles_fts
       WHERE articles_fts MATCH 'title:${term}* OR content:${term}*'
+      ${tags.length > 0 ? "AND " + tagFilter("id", tags) : ""}
       ORDER BY RANK
       LIMIT 100
-      `);
+      `,
+        tags
+      ).concat(searchHeadings(term, tags));
+
+      if (withHistory) {
+        rows = rows.concat(searchHistory(term, tags));
+      }
+
+      return rows;
+    }
+
+    return query(
+      `
+      SELECT
+        uri,
+        title,
+        title as highlightedTitle,
+        COALESCE(description, '') as content
+      FROM articles
+      WHERE ${tagFilter("id", tags)}
+      ORDER BY title COLLATE NOCASE
+      `,
+      tags
+    );
+  };
+
+  // Searches finish in whatever order they like. Only show the latest one.
+  let latestSearch = 0;
+
+  const search = async () => {
+    const words = termInput.value.trim().split(/\s+/);
+    const tags = words
+      .filter((w) => w.length > 1 && w.startsWith("#"))
+      .map((w) => w.slice(1).replace(/_/g, " "));
+    const term = words.filter((w) => !w.startsWith("#")).join(" ");
+    const withHistory = !!(historyInput && historyInput.checked);
+    const thisSearch = ++latestSearch;
+
+    // Terms shorter than three letters match too much to be useful
+    const searchTerm = term.length >= 3 ? term : "";
+
+    let rows = null;
+
+    if (searchTerm || tags.length > 0) {
+      const q = [searchTerm]
+        .concat(words.filter((w) => w.startsWith("#")))
+        .join(" ")
+        .trim();
 
-      let rows = [];
-      while (thingSearchStatement.step()) {
-        const row = thingSearchStatement.getAsObject();
-        rows.push(row);
+      if (searchRemotely) {
+        rows = await searchServer(q, withHistory);
+      } else if (db) {
+        rows = searchHere(searchTerm, tags, withHistory);
+      } else {
+        rows = await searchJSON(searchTerm, tags);
       }
+    }
 
-      thingSearchStatement.free();
+    if (thisSearch !== latestSearch) {
+      return;
+    }
 
+    if (rows) {
       const summary =
         rows.length > 1
           ? rows.length.toString() + " results"
@@ -69,7 +242,7 @@ const REMOTE_DATABASE = "/articles.db";
           ? "One result"
           : "No Results :/";
 
-      countSection.innerHTML = term + " <span>" + summary + "</span>";
+      countSection.innerHTML = termInput.value + " <span>" + summary + "</span>";
       treeSection.style.display = "none";
       resultsSection.style.display = "block";
       resultsSection.innerHTML = renderer.renderString(template, {
@@ -82,5 +255,11 @@ const REMOTE_DATABASE = "/articles.db";
       treeSection.style.display = "block";
       resultsSection.style.display = "none";
     }
-  });
+  };
+
+  termInput.addEventListener("keyup", search);
+
+  if (historyInput) {
+    historyInput.addEventListener("change", search);
+  }
 })();
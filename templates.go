@@ -0,0 +1,141 @@
+package bock
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+
+	"github.com/flosch/pongo2/v5"
+)
+
+//go:embed template
+var templatesContent embed.FS
+
+// The templates we need, by the type of page they render. Each one is
+// `<type>.njk` in the template folder. Partials like `base.njk` are checked
+// when these are compiled.
+var requiredTemplates = []string{
+	"archive",
+	"article",
+	"folder",
+	"index",
+	"not-found",
+	"random",
+	"recent",
+	"revision",
+	"revision-compare",
+	"revision-diff",
+	"revision-list",
+	"revision-raw",
+	"tag",
+	"tag-list",
+}
+
+// The required templates, compiled for one build. Builds can have different
+// templates and site configs so none of this is shared between them.
+type compiledTemplates struct {
+	set       *pongo2.TemplateSet
+	templates map[string]*pongo2.Template
+}
+
+// Two filesystems on top of each other. Files in `upper` win and everything
+// else comes from `lower`. Folders list what's in both.
+type layeredFS struct {
+	upper fs.FS
+	lower fs.FS
+}
+
+func (l layeredFS) Open(name string) (fs.File, error) {
+	if f, err := l.upper.Open(name); err == nil {
+		return f, nil
+	}
+
+	return l.lower.Open(name)
+}
+
+func (l layeredFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	upper, upperErr := fs.ReadDir(l.upper, name)
+	lower, lowerErr := fs.ReadDir(l.lower, name)
+
+	if upperErr != nil && lowerErr != nil {
+		return nil, lowerErr
+	}
+
+	entries := make(map[string]fs.DirEntry)
+	for _, e := range lower {
+		entries[e.Name()] = e
+	}
+	for _, e := range upper {
+		entries[e.Name()] = e
+	}
+
+	merged := []fs.DirEntry{}
+	for _, e := range entries {
+		merged = append(merged, e)
+	}
+
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name() < merged[j].Name() })
+
+	return merged, nil
+}
+
+// Render a template. Templates can still fail here (like when a filter gets
+// something it can't deal with) and that has to be reported instead of being
+// written out as an empty page.
+func (c *compiledTemplates) execute(name string, context pongo2.Context) (string, error) {
+	html, err := c.templates[name].Execute(context)
+	if err != nil {
+		return "", fmt.Errorf("the '%s' template failed: %w", name, err)
+	}
+
+	return html, nil
+}
+
+// Make the set of templates to render the wiki with: the embedded ones, with
+// anything in `templateFolder` (if given) taking their place. Every required
+// template must be there and compile. The site config is available to all of
+// them as `site`. Returns where the templates (and their stylesheets, scripts,
+// and images) come from along with the compiled templates.
+func loadTemplates(templateFolder string, site SiteConfig) (fs.FS, *compiledTemplates, error) {
+	embedded, _ := fs.Sub(templatesContent, "template")
+	var templates fs.FS = embedded
+
+	if templateFolder != "" {
+		if info, err := os.Stat(templateFolder); err != nil || !info.IsDir() {
+			return nil, nil, fmt.Errorf("'%s' is not a folder", templateFolder)
+		}
+
+		templates = layeredFS{
+			upper: os.DirFS(templateFolder),
+			lower: embedded,
+		}
+	}
+
+	compiled := &compiledTemplates{
+		set:       pongo2.NewSet("template", pongo2.NewFSLoader(templates)),
+		templates: make(map[string]*pongo2.Template),
+	}
+
+	compiled.set.Globals["site"] = site
+	var errs []error
+
+	for _, name := range requiredTemplates {
+		if _, err := fs.Stat(templates, name+".njk"); err != nil {
+			errs = append(errs, fmt.Errorf("could not find the '%s' template (%s.njk)", name, name))
+			continue
+		}
+
+		t, err := compiled.set.FromFile(name + ".njk")
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not compile the '%s' template: %w", name, err))
+			continue
+		}
+
+		compiled.templates[name] = t
+	}
+
+	return templates, compiled, errors.Join(errs...)
+}
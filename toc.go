@@ -0,0 +1,130 @@
+package bock
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// Every heading gets an ID made from its text, like `#how-to-reload-pf` for
+// "How to Reload pf". IDs only depend on the heading itself (and how many
+// headings before it have the same text) so links to them survive edits
+// elsewhere in the article. You can also pick one with `## Heading {#some-id}`.
+
+// Lowercase letters and numbers, with anything that separates words turned
+// into a single dash
+func makeHeadingID(heading string) string {
+	var id strings.Builder
+	dash := false
+
+	for _, r := range strings.ToLower(strings.TrimSpace(heading)) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			id.WriteRune(r)
+			dash = false
+
+		case unicode.IsSpace(r) || r == '-' || r == '_':
+			if id.Len() > 0 && !dash {
+				id.WriteRune('-')
+				dash = true
+			}
+		}
+	}
+
+	return strings.TrimSuffix(id.String(), "-")
+}
+
+// Hands out heading IDs for a single article. Repeated headings get `-1`,
+// `-2`, and so on.
+type headingIDs struct {
+	used map[string]bool
+}
+
+func newHeadingIDs() *headingIDs {
+	return &headingIDs{used: make(map[string]bool)}
+}
+
+func (ids *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	id := makeHeadingID(string(value))
+	if id == "" {
+		id = "heading"
+	}
+
+	unique := id
+	for i := 1; ids.used[unique]; i++ {
+		unique = fmt.Sprintf("%s-%d", id, i)
+	}
+
+	ids.used[unique] = true
+
+	return []byte(unique)
+}
+
+func (ids *headingIDs) Put(value []byte) {
+	ids.used[string(value)] = true
+}
+
+// How deep an article's table of contents goes. Frontmatter wins over the site
+// config and zero means no table of contents.
+func makeTOCDepth(frontmatter frontmatter, config *bockConfig) int {
+	if frontmatter.TOC != nil {
+		return *frontmatter.TOC
+	}
+
+	return config.site.TOC
+}
+
+// Every heading in an article, in order
+func makeHeadings(document ast.Node, source []byte) []tocEntry {
+	headings := []tocEntry{}
+
+	ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := node.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+
+		id, _ := heading.AttributeString("id")
+		idBytes, _ := id.([]byte)
+
+		headings = append(headings, tocEntry{
+			ID:    string(idBytes),
+			Level: heading.Level,
+			Title: strings.TrimSpace(string(heading.Text(source))),
+		})
+
+		return ast.WalkSkipChildren, nil
+	})
+
+	return headings
+}
+
+// Headings down to `depth` (so 3 is `<h1>` to `<h3>`), nested under the
+// heading before them with a smaller level
+func makeTOC(headings []tocEntry, depth int) []tocEntry {
+	if depth < 1 {
+		return nil
+	}
+
+	root := &tocEntry{}
+	stack := []*tocEntry{root}
+
+	for _, heading := range headings {
+		if heading.Level > depth {
+			continue
+		}
+
+		for len(stack) > 1 && stack[len(stack)-1].Level >= heading.Level {
+			stack = stack[:len(stack)-1]
+		}
+
+		parent := stack[len(stack)-1]
+		parent.Children = append(parent.Children, heading)
+
+		stack = append(stack, &parent.Children[len(parent.Children)-1])
+	}
+
+	return root.Children
+}
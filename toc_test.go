@@ -0,0 +1,103 @@
+package bock
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMakeHeadingID(t *testing.T) {
+	tests := []struct {
+		heading string
+		want    string
+	}{
+		{"How to Reload pf", "how-to-reload-pf"},
+		{"  Spaces -- and_underscores  ", "spaces-and-underscores"},
+		{"What's `pfctl`?", "whats-pfctl"},
+		{"Café Crème", "café-crème"},
+		{"¯\\_(ツ)_/¯", "ツ"},
+		{"!!!", ""},
+	}
+
+	for _, tt := range tests {
+		if got := makeHeadingID(tt.heading); got != tt.want {
+			t.Errorf("makeHeadingID(%q) is %q, want %q", tt.heading, got, tt.want)
+		}
+	}
+}
+
+func TestMakeHeadings(t *testing.T) {
+	_, headings, _, err := convertMarkdown([]byte("# pf\n## Rules\n## Rules\n## !!!\n## Tables {#my-tables}\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []tocEntry{
+		{ID: "pf", Level: 1, Title: "pf"},
+		{ID: "rules", Level: 2, Title: "Rules"},
+		{ID: "rules-1", Level: 2, Title: "Rules"},
+		{ID: "heading", Level: 2, Title: "!!!"},
+		{ID: "my-tables", Level: 2, Title: "Tables"},
+	}
+
+	if !reflect.DeepEqual(headings, want) {
+		t.Errorf("got %+v, want %+v", headings, want)
+	}
+}
+
+func TestMakeTOC(t *testing.T) {
+	h := func(level int, title string, children ...tocEntry) tocEntry {
+		return tocEntry{ID: title, Level: level, Title: title, Children: children}
+	}
+
+	tests := []struct {
+		name     string
+		headings []tocEntry
+		depth    int
+		want     []tocEntry
+	}{
+		{
+			name:     "nested",
+			headings: []tocEntry{h(1, "a"), h(2, "b"), h(3, "c"), h(2, "d"), h(1, "e")},
+			depth:    3,
+			want:     []tocEntry{h(1, "a", h(2, "b", h(3, "c")), h(2, "d")), h(1, "e")},
+		},
+		{
+			name:     "skipping levels",
+			headings: []tocEntry{h(1, "a"), h(3, "b"), h(2, "c"), h(4, "d"), h(3, "e")},
+			depth:    4,
+			want:     []tocEntry{h(1, "a", h(3, "b"), h(2, "c", h(4, "d"), h(3, "e")))},
+		},
+		{
+			name:     "starting deeper than later headings",
+			headings: []tocEntry{h(3, "a"), h(2, "b"), h(1, "c")},
+			depth:    3,
+			want:     []tocEntry{h(3, "a"), h(2, "b"), h(1, "c")},
+		},
+		{
+			name:     "too deep",
+			headings: []tocEntry{h(1, "a"), h(2, "b"), h(3, "c"), h(2, "d")},
+			depth:    2,
+			want:     []tocEntry{h(1, "a", h(2, "b"), h(2, "d"))},
+		},
+		{
+			name:     "turned off",
+			headings: []tocEntry{h(1, "a")},
+			depth:    0,
+			want:     nil,
+		},
+		{
+			name:     "no headings",
+			headings: []tocEntry{},
+			depth:    3,
+			want:     nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := makeTOC(tt.headings, tt.depth); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
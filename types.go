@@ -1,67 +1,120 @@
-package main
+package bock
 
 import (
+	"context"
 	"database/sql"
+	"io"
+	"io/fs"
 	"time"
 
-	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 )
 
-type Revision struct {
+type revision struct {
 	AuthorEmail string    `json:"authorEmail"`
 	AuthorName  string    `json:"authorName"`
 	Date        time.Time `json:"date"`
 	Id          string    `json:"id"`
+	Path        string    `json:"path"`
 	ShortId     string    `json:"shortId"`
 	Subject     string    `json:"subject"`
-	Content     string    `json:"content"`
+	Body        string    `json:"body"`
+	Content     string    `json:"content,omitempty"`
+
+	// Where to find the contents of this revision. These are loaded lazily.
+	blobHash plumbing.Hash
+}
+
+// A commit that changed one or more articles
+type change struct {
+	Articles    []hierarchicalEntity `json:"articles"`
+	AuthorEmail string               `json:"authorEmail"`
+	AuthorName  string               `json:"authorName"`
+	Date        time.Time            `json:"date"`
+	Id          string               `json:"id"`
+	ShortId     string               `json:"shortId"`
+	Subject     string               `json:"subject"`
+	Body        string               `json:"body"`
+
+	// Relative paths of the articles that were changed
+	paths []string
 }
 
-type HierarchicalEntity struct {
+type hierarchicalEntity struct {
 	Name string `json:"name"`
 	Type string `json:"type"`
 	URI  string `json:"uri"`
 }
 
-type Children struct {
-	Articles []HierarchicalEntity `json:"articles"`
-	Folders  []HierarchicalEntity `json:"folders"`
+type children struct {
+	Articles []hierarchicalEntity `json:"articles"`
+	Folders  []hierarchicalEntity `json:"folders"`
+}
+
+type frontmatter struct {
+	Aliases     []string  `json:"aliases" yaml:"aliases" toml:"aliases"`
+	Categories  []string  `json:"categories" yaml:"categories" toml:"categories"`
+	Date        time.Time `json:"date" yaml:"date" toml:"date"`
+	Description string    `json:"description" yaml:"description" toml:"description"`
+	Draft       bool      `json:"draft" yaml:"draft" toml:"draft"`
+	Tags        []string  `json:"tags" yaml:"tags" toml:"tags"`
+	Title       string    `json:"title" yaml:"title" toml:"title"`
+	TOC         *int      `json:"toc" yaml:"toc" toml:"toc"`
 }
 
-type Article struct {
+type article struct {
+	Aliases      []string             `json:"aliases"`
+	Backlinks    []hierarchicalEntity `json:"backlinks"`
 	Created      time.Time            `json:"created"`
-	Hierarchy    []HierarchicalEntity `json:"hierarchy"`
+	Date         time.Time            `json:"date"`
+	Description  string               `json:"description"`
+	Draft        bool                 `json:"draft"`
+	Hierarchy    []hierarchicalEntity `json:"hierarchy"`
 	Html         string               `json:"html"`
 	ID           string               `json:"id"`
 	Modified     time.Time            `json:"modified"`
-	Revisions    []Revision           `json:"revisions"`
+	Revisions    []revision           `json:"revisions"`
 	Size         int64                `json:"sizeInBytes"`
 	Source       string               `json:"source"`
+	Tags         []string             `json:"tags"`
 	Title        string               `json:"title"`
+	TOC          []tocEntry           `json:"toc"`
 	Untracked    bool                 `json:"untracked"`
 	URI          string               `json:"uri"`
 	RelativePath string               `json:"relativePath"`
 
 	// You do NOT want to make this public!
-	path string
+	path     string
+	tocDepth int
+	headings []tocEntry
+}
+
+// A heading in an article's table of contents and the headings under it
+type tocEntry struct {
+	Children []tocEntry `json:"children"`
+	ID       string     `json:"id"`
+	Level    int        `json:"level"`
+	Title    string     `json:"title"`
 }
 
-type Folder struct {
-	Children  Children             `json:"children"`
-	Hierarchy []HierarchicalEntity `json:"hierarchy"`
+type folder struct {
+	Children  children             `json:"children"`
+	Hierarchy []hierarchicalEntity `json:"hierarchy"`
 	ID        string               `json:"id"`
 	README    string               `json:"readme"`
 	Title     string               `json:"title"`
 	URI       string               `json:"uri"`
 }
 
-type Entity struct {
-	Children     *[]Entity `json:"children"`
+type entity struct {
+	Aliases      []string  `json:"aliases"`
+	Children     *[]entity `json:"children"`
 	IsFolder     bool      `json:"isFolder"`
 	Modified     time.Time `json:"modified"`
 	Name         string    `json:"name"`
 	RelativePath string    `json:"relativePath"`
 	SizeInBytes  int64     `json:"sizeInBytes"`
+	Tags         []string  `json:"tags"`
 	Title        string    `json:"title"`
 	URI          string    `json:"uri"`
 
@@ -69,7 +122,13 @@ type Entity struct {
 	path string
 }
 
-type Meta struct {
+type tag struct {
+	Articles []hierarchicalEntity `json:"articles"`
+	Name     string               `json:"name"`
+	URI      string               `json:"uri"`
+}
+
+type meta struct {
 	Architecture          string        `json:"architecture"`
 	ArticleCount          int           `json:"articleCount"`
 	BuildDate             time.Time     `json:"buildTime"`
@@ -83,17 +142,75 @@ type Meta struct {
 	MemoryInGB            int           `json:"memoryInGB"`
 	Platform              string        `json:"platform"`
 	RevisionCount         int           `json:"revisionCount"`
+	SearchIndex           string        `json:"searchIndex"`
+	TagCount              int           `json:"tagCount"`
 }
 
-type BockConfig struct {
+// Everything in `bock.yaml`. Available to every template as `site`.
+type SiteConfig struct {
+	// Shown in page titles and wherever the wiki needs a name
+	Title string `yaml:"title"`
+
+	// Same as `--base-url`, which wins if you use both
+	BaseURL string `yaml:"baseURL"`
+
+	// Where to edit an article, with `{path}` standing in for the article's path
+	// relative to the article root. For example,
+	// https://github.com/you/articles/edit/main/{path}
+	EditURL string `yaml:"editURL"`
+
+	// The name of the article the wiki starts at, without `.md`
+	Home    string `yaml:"home"`
+	HomeURI string `yaml:"-"`
+
+	// Whether pages load MathJax to render the math in articles
+	MathJax bool `yaml:"mathjax"`
+
+	// Bits of HTML to add to the <head> of every page, like analytics scripts
+	Head []string `yaml:"head"`
+
+	// How many levels of headings go in each article's table of contents. Zero
+	// turns it off. Articles can change this with `toc` in their frontmatter.
+	TOC int `yaml:"toc"`
+
+	// Patterns of articles and folders to leave out, like `drafts` or `*.wip.md`
+	Ignore []string `yaml:"ignore"`
+
+	// Command-line flags to use by default, like `--with-json-files`. Flags you
+	// give on the command line win.
+	Flags []string `yaml:"flags"`
+}
+
+type bockConfig struct {
 	articleRoot    string
-	entityTree     *[]Entity
-	listOfArticles *[]Entity
+	articles       fs.FS
+	baseURL        string
+	entityTree     *[]entity
+	git            gitBackend
+	jobs           int
+	listOfArticles *[]entity
 	listOfFolders  *[]string
+	listOfTags     *[]tag
 	database       *sql.DB
-	meta           Meta
-	outputFolder   string
-	repository     *git.Repository
+	meta           meta
+	output         Output
 	started        time.Time
-	workTreeStatus *git.Status
+	stats          *buildStats
+	site           SiteConfig
+	wikiLinks      *wikiLinkIndex
+	keepGoing      bool
+	links          *linkGraph
+	templates      fs.FS
+	compiled       *compiledTemplates
+	ctx            context.Context
+	log            io.Writer
+
+	// Where the database is being built when it isn't in the output folder.
+	// It's copied to the output once it's done.
+	databaseFile string
+
+	// What we're building now and what we built the last time, if anything.
+	// The latter is nil if we're building everything from scratch.
+	manifest         *manifest
+	previousManifest *manifest
 }
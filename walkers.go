@@ -1,24 +1,19 @@
-package main
+package bock
 
 import (
 	"errors"
-	"fmt"
 	"io/fs"
-	"os"
 	"path"
 	"path/filepath"
 	"sort"
 	"strings"
 	"time"
-
-	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing/object"
 )
 
-func makeHierarchy(path string, articleRoot string) []HierarchicalEntity {
+func makeHierarchy(path string, articleRoot string) []hierarchicalEntity {
 	a := strings.Replace(path, articleRoot, "", -1)
 	b := strings.Split(a, "/")
-	c := []HierarchicalEntity{}
+	c := []hierarchicalEntity{}
 
 	uriPath := ""
 
@@ -26,7 +21,7 @@ func makeHierarchy(path string, articleRoot string) []HierarchicalEntity {
 		uri := strings.ReplaceAll(strings.TrimSuffix(p, filepath.Ext(p)), " ", "_")
 
 		if p == "" {
-			c = append(c, HierarchicalEntity{
+			c = append(c, hierarchicalEntity{
 				Name: "ROOT",
 				Type: "folder",
 				URI:  "/ROOT",
@@ -41,7 +36,7 @@ func makeHierarchy(path string, articleRoot string) []HierarchicalEntity {
 				type_ = "article"
 			}
 
-			c = append(c, HierarchicalEntity{
+			c = append(c, hierarchicalEntity{
 				Name: name,
 				Type: type_,
 				URI:  uriPath,
@@ -52,72 +47,37 @@ func makeHierarchy(path string, articleRoot string) []HierarchicalEntity {
 	return c
 }
 
-type ArticleHistory struct {
+type articleHistory struct {
 	created   time.Time
 	modified  time.Time
-	revisions []Revision
+	revisions []revision
 }
 
-func getArticleHistory(articlePath string, config *BockConfig) (ArticleHistory, error) {
+func getArticleHistory(articlePath string, config *bockConfig) (articleHistory, error) {
 	relativePath := makeRelativePath(articlePath, config.articleRoot)
-	revisions := []Revision{}
-	ret := ArticleHistory{}
+	ret := articleHistory{}
 
-	// TODO: Why does this not work with in-memory FS?
-	if config.workTreeStatus.IsUntracked(relativePath) {
+	if config.git.IsUntracked(relativePath) {
 		return ret, errors.New("file is untracked")
 	}
 
-	commits, _ := config.repository.Log(&git.LogOptions{FileName: &relativePath})
-
-	commits.ForEach(func(c *object.Commit) error {
-		fc, err := c.Files()
-
-		if err != nil {
-			fmt.Println("Could not get files for commit: ", c.Hash)
-		} else {
-			fc.ForEach(func(f *object.File) error {
-				if f.Name == relativePath {
-					rev := Revision{}
-
-					rev.AuthorEmail = c.Author.Email
-					rev.AuthorName = c.Author.Name
-					rev.Date = c.Author.When.UTC()
-					rev.Id = c.Hash.String()
-					rev.ShortId = c.Hash.String()[0:8]
-					rev.Subject = c.Message
-
-					contents, _ := f.Contents()
-					rev.Content = string(contents)
-
-					revisions = append(revisions, rev)
-				}
-
-				return nil
-			})
-		}
-
-		return nil
-	})
-
-	sort.Slice(revisions, func(i, j int) bool {
-		return revisions[i].Date.After(revisions[j].Date)
-	})
+	// Newest revisions are first
+	revisions, err := config.git.History(relativePath)
 
-	if len(revisions) == 0 {
+	if err != nil || len(revisions) == 0 {
 		return ret, errors.New("file is untracked")
 	}
 
-	ret.created = revisions[0].Date.UTC()
-	ret.modified = revisions[len(revisions)-1].Date.UTC()
+	ret.created = revisions[len(revisions)-1].Date.UTC()
+	ret.modified = revisions[0].Date.UTC()
 	ret.revisions = revisions
 
 	return ret, nil
 }
 
-func getEntityInfo(config *BockConfig, info fs.FileInfo, path string) *Entity {
-	entity := Entity{
-		Children:     &[]Entity{},
+func getEntityInfo(config *bockConfig, info fs.FileInfo, path string) *entity {
+	entity := entity{
+		Children:     &[]entity{},
 		IsFolder:     info.IsDir(),
 		Modified:     info.ModTime(),
 		Name:         info.Name(),
@@ -128,15 +88,83 @@ func getEntityInfo(config *BockConfig, info fs.FileInfo, path string) *Entity {
 		URI:          makeURI(path, config.articleRoot),
 	}
 
+	// Articles can override their titles, have aliases, and be tagged in their
+	// frontmatter
+	if !info.IsDir() && filepath.Ext(path) == ".md" {
+		if contents, err := readArticleFile(path, config); err == nil {
+			frontmatter, _, _ := parseFrontmatter(contents)
+
+			if frontmatter.Title != "" {
+				entity.Title = frontmatter.Title
+			}
+
+			entity.Aliases = frontmatter.Aliases
+			entity.Tags = tagsIn(frontmatter)
+		}
+	}
+
 	return &entity
 }
 
-func makeEntityTree(config *BockConfig) []Entity {
-	tree := []Entity{}
+// Gather every tag in the article repository along with the articles that use
+// it. Tags are sorted by name and their articles by title. Tags that are
+// spelled differently (like "Linux" and "linux") but have the same URI are
+// merged and named whatever most articles call them.
+func makeListOfTags(config *bockConfig) []tag {
+	articlesByTag := make(map[string][]hierarchicalEntity)
+	spellings := make(map[string]map[string]int)
+
+	for _, article := range *config.listOfArticles {
+		for _, tag := range article.Tags {
+			uri := makeTagURI(tag)
+
+			articlesByTag[uri] = append(articlesByTag[uri], hierarchicalEntity{
+				Name: article.Title,
+				Type: "article",
+				URI:  article.URI,
+			})
+
+			if spellings[uri] == nil {
+				spellings[uri] = make(map[string]int)
+			}
+
+			spellings[uri][tag] += 1
+		}
+	}
+
+	listOfTags := []tag{}
+	for uri, articles := range articlesByTag {
+		sort.Slice(articles, func(i, j int) bool {
+			return strings.ToLower(articles[i].Name) < strings.ToLower(articles[j].Name)
+		})
+
+		name := ""
+		for spelling, count := range spellings[uri] {
+			if best := spellings[uri][name]; count > best || (count == best && spelling < name) {
+				name = spelling
+			}
+		}
+
+		listOfTags = append(listOfTags, tag{
+			Articles: articles,
+			Name:     name,
+			URI:      uri,
+		})
+	}
+
+	sort.Slice(listOfTags, func(i, j int) bool {
+		return strings.ToLower(listOfTags[i].Name) < strings.ToLower(listOfTags[j].Name)
+	})
+
+	return listOfTags
+}
+
+func makeEntityTree(config *bockConfig) []entity {
+	tree := []entity{}
 
 	// Bootstrap: create adn append the root entity (a folder)
-	tree = append(tree, Entity{
-		Children:     &[]Entity{},
+	tree = append(tree, entity{
+		Children:     &[]entity{},
 		IsFolder:     true,
 		Modified:     time.Now(),
 		Name:         "ROOT",
@@ -174,8 +202,8 @@ func makeEntityTree(config *BockConfig) []Entity {
 				} else {
 					// We need to create a new folder here.
 					//
-					*subEntity.Children = append(*subEntity.Children, Entity{
-						Children:     &[]Entity{},
+					*subEntity.Children = append(*subEntity.Children, entity{
+						Children:     &[]entity{},
 						IsFolder:     true,
 						Modified:     time.Now(),
 						Name:         fragment,
@@ -198,16 +226,34 @@ func makeEntityTree(config *BockConfig) []Entity {
 	return tree
 }
 
-func makeListOfEntities(config *BockConfig) (
-	listOfArticles []Entity,
+func makeListOfEntities(config *bockConfig) (
+	listOfArticles []entity,
 	listOfFolders []string,
 	err error,
 ) {
-	walkFunction := func(entityPath string, entityInfo os.FileInfo, walkErr error) error {
+	walkFunction := func(name string, d fs.DirEntry, walkErr error) error {
+		// Skip anything we can't read
+		if walkErr != nil {
+			return nil
+		}
+
+		entityInfo, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		entityPath := config.articleRoot
+		if name != "." {
+			entityPath += "/" + name
+		}
+
 		relativePath := makeRelativePath(entityPath, config.articleRoot)
 
+		// Home is dealt with separately
 		isValidArticle := (!entityInfo.IsDir() &&
-			!IGNORED_ENTITIES_REGEX.MatchString(entityPath) &&
+			relativePath != config.site.Home+".md" &&
+			!ignoredEntitiesRegex.MatchString(entityPath) &&
+			!isIgnored(relativePath, config) &&
 			!hasDotEntities(path.Dir(relativePath)) &&
 			filepath.Ext(entityPath) == ".md")
 
@@ -256,8 +302,43 @@ func makeListOfEntities(config *BockConfig) (
 
 	// It strikes me that error-handling in Go is a bit strange... looks like
 	// things can just fall through.
-	err = filepath.Walk(config.articleRoot, walkFunction)
+	err = fs.WalkDir(config.articles, ".", walkFunction)
 	listOfFolders = uniqueStringsInList(listOfFolders)
 
 	return listOfArticles, listOfFolders, err
 }
+
+// Get the latest changes to the wiki and figure out which articles they touched.
+// Articles that no longer exist are left out, as are changes that only touched
+// articles that no longer exist.
+func makeListOfRecentChanges(config *bockConfig) ([]change, error) {
+	articlesByPath := map[string]hierarchicalEntity{
+		config.site.Home + ".md": {Name: config.site.Home, Type: "article", URI: config.site.HomeURI},
+	}
+
+	for _, a := range *config.listOfArticles {
+		articlesByPath[a.RelativePath] = hierarchicalEntity{
+			Name: a.Title,
+			Type: "article",
+			URI:  a.URI,
+		}
+	}
+
+	changes, err := config.git.RecentChanges(recentChangesCount, func(p string) bool {
+		_, ok := articlesByPath[p]
+		return ok
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, c := range changes {
+		changes[i].Articles = []hierarchicalEntity{}
+
+		for _, p := range c.paths {
+			changes[i].Articles = append(changes[i].Articles, articlesByPath[p])
+		}
+	}
+
+	return changes, nil
+}
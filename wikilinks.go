@@ -0,0 +1,228 @@
+package bock
+
+import (
+	"bytes"
+	"path"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Wiki links look like `[[Title]]`, `[[Folder/Title]]`, or `[[Title|label]]`
+// and can point at a heading with `[[Title#Heading]]`. They're resolved against
+// the articles we're building, in this order:
+//
+//  1. The article's path, like `Tech/BSD/pf Notes`
+//  2. The article's file name, title, or one of its aliases, as long as only
+//     one article has it
+//
+// Spaces and underscores are the same thing (just like in URIs) and case is
+// ignored. Links that don't resolve still link to where the article would be
+// but get a `missing` class.
+
+var kindWikiLink = ast.NewNodeKind("WikiLink")
+
+type wikiLink struct {
+	ast.BaseInline
+
+	Target      string
+	Label       string
+	Destination string
+	Missing     bool
+}
+
+func (n *wikiLink) Kind() ast.NodeKind {
+	return kindWikiLink
+}
+
+func (n *wikiLink) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{
+		"Target":      n.Target,
+		"Destination": n.Destination,
+	}, nil)
+}
+
+// Where each link can go. Built once per build and only read after that.
+type wikiLinkIndex struct {
+	byPath map[string]string
+	byName map[string]string
+}
+
+// What a single conversion needs: the index, and somewhere to keep the links
+// that didn't resolve. A nil index resolves nothing and reports nothing (this
+// is what we do for old revisions).
+type wikiLinkContext struct {
+	index   *wikiLinkIndex
+	missing []string
+}
+
+var wikiLinkContextKey = parser.NewContextKey()
+
+func normalizeWikiLinkTarget(target string) string {
+	target = strings.TrimSuffix(strings.Trim(strings.TrimSpace(target), "/"), ".md")
+	return strings.ToLower(strings.ReplaceAll(target, " ", "_"))
+}
+
+func makeWikiLinkIndex(config *bockConfig) *wikiLinkIndex {
+	index := &wikiLinkIndex{
+		byPath: make(map[string]string),
+		byName: make(map[string]string),
+	}
+
+	// Ambiguous names resolve to nothing
+	addName := func(name string, uri string) {
+		key := normalizeWikiLinkTarget(name)
+		if existing, ok := index.byName[key]; ok && existing != uri {
+			index.byName[key] = ""
+			return
+		}
+
+		index.byName[key] = uri
+	}
+
+	index.byPath[normalizeWikiLinkTarget(config.site.Home)] = config.site.HomeURI
+
+	for _, a := range *config.listOfArticles {
+		index.byPath[normalizeWikiLinkTarget(a.RelativePath)] = a.URI
+
+		addName(path.Base(a.RelativePath), a.URI)
+		addName(a.Title, a.URI)
+
+		for _, alias := range a.Aliases {
+			addName(alias, a.URI)
+		}
+	}
+
+	return index
+}
+
+func (index *wikiLinkIndex) resolve(target string) (string, bool) {
+	key := normalizeWikiLinkTarget(target)
+
+	if uri, ok := index.byPath[key]; ok {
+		return uri, true
+	}
+
+	if uri := index.byName[key]; uri != "" {
+		return uri, true
+	}
+
+	return makeWikiLinkURI(target), false
+}
+
+// Where an article would be if it existed
+func makeWikiLinkURI(target string) string {
+	return "/" + strings.ReplaceAll(strings.Trim(strings.TrimSpace(target), "/"), " ", "_")
+}
+
+type wikiLinkParser struct{}
+
+func (p *wikiLinkParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+func (p *wikiLinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if !bytes.HasPrefix(line, []byte("[[")) {
+		return nil
+	}
+
+	end := bytes.Index(line[2:], []byte("]]"))
+	if end < 1 {
+		return nil
+	}
+
+	inner := string(line[2 : 2+end])
+	if strings.ContainsAny(inner, "[]\n") {
+		return nil
+	}
+
+	target, label, hasLabel := strings.Cut(inner, "|")
+	target, heading, _ := strings.Cut(target, "#")
+	target = strings.TrimSpace(target)
+
+	if target == "" {
+		return nil
+	}
+
+	if !hasLabel {
+		label = inner
+	}
+
+	block.Advance(end + 4)
+
+	link := &wikiLink{
+		Target: target,
+		Label:  strings.TrimSpace(label),
+	}
+
+	uri := makeWikiLinkURI(target)
+	resolved := true
+
+	if ctx, ok := pc.Get(wikiLinkContextKey).(*wikiLinkContext); ok && ctx.index != nil {
+		uri, resolved = ctx.index.resolve(target)
+
+		if !resolved {
+			ctx.missing = append(ctx.missing, target)
+		}
+	}
+
+	if heading != "" {
+		uri += "#" + makeHeadingID(heading)
+	}
+
+	link.Destination = uri
+	link.Missing = !resolved
+
+	return link
+}
+
+type wikiLinkRenderer struct{}
+
+func (r *wikiLinkRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindWikiLink, r.render)
+}
+
+func (r *wikiLinkRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	link := node.(*wikiLink)
+
+	w.WriteString(`<a href="`)
+	w.Write(util.EscapeHTML(util.URLEscape([]byte(link.Destination), true)))
+	w.WriteString(`"`)
+
+	if link.Missing {
+		w.WriteString(` class="missing" title="There is no article called '`)
+		w.Write(util.EscapeHTML([]byte(link.Target)))
+		w.WriteString(`' yet"`)
+	}
+
+	w.WriteString(`>`)
+	w.Write(util.EscapeHTML([]byte(link.Label)))
+	w.WriteString(`</a>`)
+
+	return ast.WalkSkipChildren, nil
+}
+
+type wikiLinks struct{}
+
+// The goldmark extension. Runs before the regular link parser so that `[[` is
+// never mistaken for the start of a regular link.
+var wikiLinkExtension = &wikiLinks{}
+
+func (e *wikiLinks) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(
+		util.Prioritized(&wikiLinkParser{}, 199),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&wikiLinkRenderer{}, 199),
+	))
+}
@@ -0,0 +1,125 @@
+package bock
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWikiLinks(t *testing.T) {
+	config := bockConfig{
+		site: DefaultSiteConfig(),
+		listOfArticles: &[]entity{
+			{Title: "pf Notes", URI: "/Tech/BSD/pf_Notes", RelativePath: "Tech/BSD/pf Notes.md", Aliases: []string{"Packet Filter", "Firewall"}},
+			{Title: "iptables", URI: "/Tech/Linux/iptables", RelativePath: "Tech/Linux/iptables.md", Aliases: []string{"Firewall"}},
+			{Title: "pf Notes", URI: "/Old/pf_Notes", RelativePath: "Old/pf Notes.md"},
+		},
+	}
+
+	index := makeWikiLinkIndex(&config)
+
+	tests := []struct {
+		name    string
+		source  string
+		html    string
+		missing []string
+	}{
+		{
+			name:   "by path",
+			source: "[[Tech/BSD/pf Notes]]",
+			html:   `<p><a href="/Tech/BSD/pf_Notes">Tech/BSD/pf Notes</a></p>`,
+		},
+		{
+			name:   "by path, ignoring case and underscores",
+			source: "[[tech/bsd/PF_notes]]",
+			html:   `<p><a href="/Tech/BSD/pf_Notes">tech/bsd/PF_notes</a></p>`,
+		},
+		{
+			name:   "by alias",
+			source: "[[Packet Filter]]",
+			html:   `<p><a href="/Tech/BSD/pf_Notes">Packet Filter</a></p>`,
+		},
+		{
+			name:   "home",
+			source: "[[home]]",
+			html:   `<p><a href="/Home">home</a></p>`,
+		},
+		{
+			name:   "with a label and a heading",
+			source: "[[Tech/BSD/pf Notes#Some Heading|pf]]",
+			html:   `<p><a href="/Tech/BSD/pf_Notes#some-heading">pf</a></p>`,
+		},
+		{
+			name:    "an ambiguous alias",
+			source:  "[[Firewall]]",
+			html:    `<p><a href="/Firewall" class="missing" title="There is no article called 'Firewall' yet">Firewall</a></p>`,
+			missing: []string{"Firewall"},
+		},
+		{
+			name:    "an ambiguous title",
+			source:  "[[pf Notes]]",
+			html:    `<p><a href="/pf_Notes" class="missing" title="There is no article called 'pf Notes' yet">pf Notes</a></p>`,
+			missing: []string{"pf Notes"},
+		},
+		{
+			name:    "only the first pipe separates the label",
+			source:  "[[a|b|c]]",
+			html:    `<p><a href="/a" class="missing" title="There is no article called 'a' yet">b|c</a></p>`,
+			missing: []string{"a"},
+		},
+		{
+			name:   "empty",
+			source: "[[]]",
+			html:   `<p>[[]]</p>`,
+		},
+		{
+			name:   "only a label",
+			source: "[[ | x]]",
+			html:   `<p>[[ | x]]</p>`,
+		},
+		{
+			name:   "brackets inside",
+			source: "[[a]b]]",
+			html:   `<p>[[a]b]]</p>`,
+		},
+		{
+			name:   "in code",
+			source: "`[[pf Notes]]`",
+			html:   `<p><code>[[pf Notes]]</code></p>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, _, missing, err := convertMarkdown([]byte(tt.source), index)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if html != tt.html+"\n" {
+				t.Errorf("got %q, want %q", html, tt.html)
+			}
+
+			if len(missing) > 0 || len(tt.missing) > 0 {
+				if !reflect.DeepEqual(missing, tt.missing) {
+					t.Errorf("got missing links %q, want %q", missing, tt.missing)
+				}
+			}
+		})
+	}
+}
+
+// Old revisions don't resolve anything or report anything missing
+func TestWikiLinksWithoutAnIndex(t *testing.T) {
+	html, _, missing, err := convertMarkdown([]byte("[[pf Notes#Rules|pf]]"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "<p><a href=\"/pf_Notes#rules\">pf</a></p>\n"; html != want {
+		t.Errorf("got %q, want %q", html, want)
+	}
+
+	if len(missing) > 0 {
+		t.Errorf("got missing links %q, want none", missing)
+	}
+}
@@ -1,116 +1,261 @@
-package main
+package bock
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	"os"
+	"io/fs"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
-	"sync"
-
-	// TODO: Implement this yourself
-	cp "github.com/otiai10/copy"
+	"testing/fstest"
+	"time"
 )
 
-func writeFile(name string, contents []byte) {
-	dirName := path.Dir(name)
+// Write a file to the output. Names are URIs, like `/Tech/pf/index.html`.
+func writeFile(name string, contents []byte, config *bockConfig) error {
+	if err := config.output.WriteFile(strings.TrimPrefix(name, "/"), contents); err != nil {
+		return err
+	}
+
+	config.stats.wroteFile(len(contents))
 
-	if m_err := os.MkdirAll(dirName, os.ModePerm); m_err != nil {
-		fmt.Println("ERROR: Could not make folder", dirName, ":", m_err)
-		fmt.Println("Halting.")
+	return nil
+}
 
-		os.Exit(EXIT_GENERAL_IO_ERROR)
+// Write a page as HTML and, if we're generating JSON, the thing it was made
+// from as JSON. Both go in `folder`.
+func writePage(folder string, html string, data interface{}, config *bockConfig) error {
+	if err := writeFile(folder+"/index.html", []byte(html), config); err != nil {
+		return err
 	}
 
-	if f_err := os.WriteFile(name, contents, os.ModePerm); f_err != nil {
-		fmt.Println("ERROR: Could not make file", name, ":", f_err)
-		fmt.Println("Halting.")
+	if !config.meta.GenerateJSON || data == nil {
+		return nil
+	}
 
-		os.Exit(EXIT_GENERAL_IO_ERROR)
+	jsonData, err := jsonMarshal(data)
+	if err != nil {
+		return err
 	}
+
+	return writeFile(folder+"/index.json", jsonData, config)
 }
 
-func copyTemplateAssets(config *BockConfig) {
+func copyTemplateAssets(config *bockConfig) error {
 	// Copy all the css, js, etc
 	for _, a := range [3]string{"css", "img", "js"} {
-		d, err := templatesContent.ReadDir("template/" + a)
-		if err != nil {
-			fmt.Print("Could not read " + a + "...skipping")
-			break
+		// Custom templates don't have to have all of them
+		d, err := fs.ReadDir(config.templates, a)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
 		}
 
-		os.MkdirAll(config.outputFolder+"/"+a, os.ModePerm)
-
 		for _, de := range d {
-			f, _ := templatesContent.ReadFile("template/" + a + "/" + de.Name())
-			writeFile(config.outputFolder+"/"+a+"/"+de.Name(), f)
+			if !config.meta.searchesDatabase() && slices.Contains(sqlJSFiles, a+"/"+de.Name()) {
+				continue
+			}
+
+			f, err := fs.ReadFile(config.templates, a+"/"+de.Name())
+			if err != nil {
+				return err
+			}
+
+			if err := writeFile("/"+a+"/"+de.Name(), f, config); err != nil {
+				return err
+			}
 		}
 	}
 
 	// Then copy anything at the root level of the template folder except the
 	// actual template HTML files!
-	d, _ := templatesContent.ReadDir("template")
+	d, err := fs.ReadDir(config.templates, ".")
+	if err != nil {
+		return err
+	}
+
 	for _, de := range d {
-		if filepath.Ext(de.Name()) != ".njk" {
-			f, _ := templatesContent.ReadFile("template/" + de.Name())
-			os.WriteFile(config.outputFolder+"/"+de.Name(), f, os.ModePerm)
+		if !de.IsDir() && filepath.Ext(de.Name()) != ".njk" {
+			f, err := fs.ReadFile(config.templates, de.Name())
+			if err != nil {
+				return err
+			}
+
+			if err := writeFile("/"+de.Name(), f, config); err != nil {
+				return err
+			}
 		}
 	}
+
+	return nil
 }
 
-func copyAssets(config *BockConfig) error {
-	err := cp.Copy(
-		config.articleRoot+"/__assets",
-		config.outputFolder+"/assets",
-	)
+// Everything in `__assets` goes in `/assets`
+func copyAssets(config *bockConfig) error {
+	return fs.WalkDir(config.articles, assetsFolder, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
 
-	return err
-}
+		contents, err := fs.ReadFile(config.articles, p)
+		if err != nil {
+			return err
+		}
 
-func writeIndex(config *BockConfig) {
-	writeFile(config.outputFolder+"/index.html", []byte(renderIndex(config)))
+		return writeFile("/assets"+strings.TrimPrefix(p, assetsFolder), contents, config)
+	})
 }
 
-func write404(config *BockConfig) {
-	writeFile(config.outputFolder+"/404.html", []byte(renderNotFound(config)))
+func writeIndex(config *bockConfig) error {
+	html, err := renderIndex(config)
+	if err != nil {
+		return err
+	}
+
+	return writeFile("/index.html", []byte(html), config)
 }
 
-func writeRevision(article Article, revision Revision, config *BockConfig) {
-	uri := makeURI(article.path, config.articleRoot)
-	os.MkdirAll(config.outputFolder+uri, os.ModePerm)
-	outputPath := config.outputFolder + uri + "/revisions/" + revision.ShortId
-	html, raw := renderRevision(article, revision)
+func write404(config *bockConfig) error {
+	html, err := renderNotFound(config)
+	if err != nil {
+		return err
+	}
 
-	writeFile(outputPath+"/index.html", []byte(html))
+	return writeFile("/404.html", []byte(html), config)
+}
+
+// Write a revision and its diff against the previous (older) revision. That
+// previous revision is empty for the very first revision of an article. Both
+// are expected to have their contents loaded.
+func writeRevision(
+	article article,
+	revision revision,
+	previous revision,
+	config *bockConfig,
+) jobResult {
+	outputPath := article.URI + "/revisions/" + revision.ShortId
+	result := jobResult{article: article.RelativePath}
+
+	html, raw, err := renderRevision(article, revision, config)
+	if err != nil {
+		result.err = err
+		return result
+	}
 
 	if config.meta.GenerateRaw {
-		writeFile(outputPath+"/raw.txt", []byte(raw))
+		if err := writeFile(outputPath+"/raw.txt", []byte(raw), config); err != nil {
+			result.err = err
+			return result
+		}
+	}
+
+	diff := makeDiff(previous.Content, revision.Content)
+	diffHTML, err := renderRevisionDiff(article, revision, previous, diff, config)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	if err := writePage(outputPath+"/diff", diffHTML, diff, config); err != nil {
+		result.err = err
+		return result
+	}
+
+	// For the comparison page, whether or not we're generating JSON
+	revisionJSON, err := jsonMarshal(revision)
+	if err == nil {
+		err = writeFile(outputPath+".json", revisionJSON, config)
+	}
+
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	// This goes last since it's how the next build knows this revision is done
+	if err := writePage(outputPath, html, revision, config); err != nil {
+		result.err = err
+		return result
 	}
 
-	if config.meta.GenerateJSON {
-		jsonData, _ := jsonMarshal(revision)
-		writeFile(outputPath+"/index.json", jsonData)
+	result.revisions = 1
+
+	return result
+}
+
+// Load the contents of all of an article's revisions. Failures are collected
+// and the revisions in question are left empty and noted in `failed`.
+func loadRevisionContents(revisions []revision, config *bockConfig) (loaded []revision, failed map[string]bool, err error) {
+	loaded = make([]revision, len(revisions))
+	failed = make(map[string]bool)
+	var errs []error
+
+	for i, revision := range revisions {
+		if revision.Content == "" {
+			content, err := config.git.Content(revision)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("could not read revision %s: %w", revision.ShortId, err))
+				failed[revision.Id] = true
+			}
+
+			revision.Content = content
+		}
+
+		loaded[i] = revision
 	}
 
-	config.meta.RevisionCount += 1
+	return loaded, failed, errors.Join(errs...)
+}
+
+// Prepared statements for putting articles in the database. Home isn't in the
+// database and doesn't get these.
+type articleStatements struct {
+	article        *sql.Stmt
+	revision       *sql.Stmt
+	deleteHeadings *sql.Stmt
+	heading        *sql.Stmt
 }
 
+// Write an article along with its revision list and comparison page. The
+// revisions themselves are returned as jobs for the worker pool.
 func writeArticle(
 	articlePath string,
-	config *BockConfig,
-	entity Entity,
-	stmt *sql.Stmt,
-) {
+	config *bockConfig,
+	entity entity,
+	statements *articleStatements,
+) jobResult {
 	fileName := entity.Name
 	title := removeExtensionFrom(fileName)
 	uri := makeURI(articlePath, config.articleRoot)
 	relativePath := makeRelativePath(articlePath, config.articleRoot)
 
-	contents, _ := os.ReadFile(articlePath)
+	result := jobResult{article: relativePath}
+
+	contents, err := readArticleFile(articlePath, config)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
 	untracked := true
 
-	var history ArticleHistory
+	// Frontmatter is metadata and never makes it into the rendered article
+	frontmatter, body, fmError := parseFrontmatter(contents)
+
+	if fmError != nil {
+		result.warnings = append(result.warnings, "Ignoring frontmatter: "+fmError.Error())
+	}
+
+	if frontmatter.Title != "" {
+		title = frontmatter.Title
+	}
+
+	tags := tagsIn(frontmatter)
+
+	var history articleHistory
 	var historyError error
 
 	if config.meta.GenerateRevisions {
@@ -121,111 +266,337 @@ func writeArticle(
 		}
 	}
 
-	article := Article{
-		Created:      history.modified,
-		Modified:     history.created,
+	// Skip articles that haven't changed since the last build. Home (which has
+	// no statement) is always written since it shows build statistics.
+	lastCommit := ""
+	if len(history.revisions) > 0 {
+		lastCommit = history.revisions[0].Id
+	}
+
+	if statements != nil {
+		unchanged := recordInManifest(relativePath, manifestEntry{
+			Hash:       hashOf(contents),
+			ID:         makeID(articlePath),
+			LastCommit: lastCommit,
+			Links:      config.links.signature(uri),
+			URI:        uri,
+		}, config)
+
+		if unchanged {
+			result.articles = 1
+			result.revisions = len(history.revisions)
+			return result
+		}
+	}
+
+	article := article{
+		Aliases:      frontmatter.Aliases,
+		Backlinks:    config.links.backlinks[uri],
+		Created:      history.created,
+		Date:         frontmatter.Date,
+		Description:  frontmatter.Description,
+		Draft:        frontmatter.Draft,
+		Modified:     history.modified,
 		Hierarchy:    makeHierarchy(articlePath, config.articleRoot),
 		Html:         "",
 		ID:           makeID(articlePath),
 		path:         articlePath,
+		tocDepth:     makeTOCDepth(frontmatter, config),
 		Revisions:    history.revisions,
 		Size:         entity.SizeInBytes,
 		Source:       string(contents),
+		Tags:         tags,
 		Title:        title,
 		Untracked:    untracked,
 		URI:          uri,
 		RelativePath: makeRelativePath(articlePath, config.articleRoot),
 	}
 
-	// Insert just the article into Database
-	// TODO: Find a way to search through revisions as well <3
-	if stmt != nil {
-		if _, s_err := stmt.Exec(
+	// Insert just the article into Database. Its revisions go in once we've
+	// read them.
+	if statements != nil {
+		var date interface{}
+		if !frontmatter.Date.IsZero() {
+			date = databaseTime(frontmatter.Date)
+		}
+
+		if _, s_err := statements.article.Exec(
 			makeID(articlePath),
-			string(contents),
-			entity.Modified.UTC(),
+			string(body),
+			databaseTime(entity.Modified),
 			title,
 			uri,
+			frontmatter.Description,
+			strings.Join(tags, ","),
+			strings.Join(frontmatter.Aliases, ","),
+			frontmatter.Draft,
+			date,
+			relativePath,
+			makeID(path.Dir(articlePath)),
 		); s_err != nil {
-			fmt.Println("ERROR: Could not update database with '"+relativePath+"': ", s_err)
-			os.Exit(EXIT_DATABASE_ERROR)
+			result.err = fmt.Errorf("could not update the database: %w", s_err)
+			return result
 		}
 	}
 
 	// Render the article HTML
-	html, raw := renderArticle(contents, article, "article", config)
-	article.Html = html
+	missingLinks, err := renderArticle(body, &article, "article", config)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	for _, l := range missingLinks {
+		result.warnings = append(result.warnings, "There is no article for [["+l+"]]")
+	}
+
+	// Headings are only known once the article's rendered
+	if statements != nil {
+		if err := insertHeadings(article.headings, article.ID, statements); err != nil {
+			result.err = err
+			return result
+		}
+	}
 
 	// Start writing things
-	writeFile(config.outputFolder+uri+"/index.html", []byte(html))
+	if err := writePage(uri, article.Html, article, config); err != nil {
+		result.err = err
+		return result
+	}
 
 	if config.meta.GenerateRaw {
-		writeFile(config.outputFolder+uri+"/raw.txt", []byte(raw))
+		if err := writeFile(uri+"/raw.txt", contents, config); err != nil {
+			result.err = err
+			return result
+		}
 	}
 
-	if config.meta.GenerateJSON {
-		jsonData, _ := jsonMarshal(article)
-		writeFile(config.outputFolder+uri+"/index.json", jsonData)
-	}
+	result.articles = 1
 
 	// Create revisions if applicable (i.e. at least one commit exists for article)
-	if config.meta.GenerateRevisions {
-		revisionsLabel := "(No revisions)"
-		if history.revisions != nil {
-			revisionsLabel = "(One revision)"
+	if config.meta.GenerateRevisions && history.revisions != nil {
+		revisionListHTML, err := renderRevisionList(article, history.revisions, config)
+		if err == nil {
+			err = writeFile(uri+"/revisions/index.html", []byte(revisionListHTML), config)
+		}
+
+		if err != nil {
+			result.err = err
+			return result
+		}
+
+		// Every revision is diffed with the one before it and any two revisions
+		// can be compared, so we need all their contents up front. Revisions we
+		// couldn't read are left out of both.
+		revisions, failed, err := loadRevisionContents(history.revisions, config)
+		result.err = err
+
+		// Revisions are searchable too. Only do this when we could read all of
+		// them: they're never updated, and the article is tried again next time
+		// if we couldn't.
+		if err == nil && statements != nil {
+			if err := insertRevisions(revisions, makeID(articlePath), statements.revision); err != nil {
+				result.err = err
+				return result
+			}
+		}
 
-			if rc := len(history.revisions); rc > 1 {
-				revisionsLabel = "(" + fmt.Sprint(rc) + " revisions)"
+		comparable := []revision{}
+		for _, r := range revisions {
+			if !failed[r.Id] {
+				comparable = append(comparable, r)
 			}
+		}
+
+		revisionCompareHTML, err := renderRevisionCompare(article, comparable, config)
+		if err == nil {
+			err = writeFile(uri+"/revisions/compare/index.html", []byte(revisionCompareHTML), config)
+		}
 
-			revisionListHTML := renderRevisionList(article, history.revisions)
-			writeFile(config.outputFolder+uri+"/revisions/index.html", []byte(revisionListHTML))
+		if err != nil {
+			result.err = err
+			return result
+		}
+
+		for i, r := range revisions {
+			r := r
+			previous := revision{}
+			if i+1 < len(revisions) {
+				previous = revisions[i+1]
+			}
+
+			// We can't show what we couldn't read, or diff against it. The
+			// article is tried again next time since there was an error.
+			if failed[r.Id] || failed[previous.Id] {
+				continue
+			}
 
-			for _, r := range history.revisions {
-				writeRevision(article, r, config)
+			// Revisions never change. If we wrote this one in a previous build
+			// (with the same templates) there's nothing left to do.
+			if config.previousManifest != nil {
+				if _, err := fs.Stat(config.output, strings.TrimPrefix(uri, "/")+"/revisions/"+r.ShortId+"/index.html"); err == nil {
+					result.revisions += 1
+					continue
+				}
 			}
+
+			result.next = append(result.next, job{
+				name: relativePath + " @ " + r.ShortId,
+				run: func() jobResult {
+					return writeRevision(article, r, previous, config)
+				},
+			})
 		}
 
-		fmt.Printf("\033[2K\r%s", relativePath+" "+revisionsLabel)
 	}
+
+	return result
 }
 
-func writeHome(config *BockConfig) {
-	homePath := config.articleRoot + "/Home.md"
-	_, h_err := os.Stat(homePath)
+func insertHeadings(headings []tocEntry, articleID string, statements *articleStatements) error {
+	if _, err := statements.deleteHeadings.Exec(articleID); err != nil {
+		return fmt.Errorf("could not update the database: %w", err)
+	}
+
+	for i, h := range headings {
+		if _, err := statements.heading.Exec(articleID, i, h.Level, h.ID, h.Title); err != nil {
+			return fmt.Errorf("could not update the database: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Revisions are searched by what's in them, like articles, so their frontmatter
+// is left out
+func insertRevisions(revisions []revision, articleID string, stmt *sql.Stmt) error {
+	for _, r := range revisions {
+		_, body, _ := parseFrontmatter([]byte(r.Content))
+
+		if _, err := stmt.Exec(
+			r.Id,
+			r.ShortId,
+			articleID,
+			r.Path,
+			string(body),
+			r.Subject,
+			r.AuthorName,
+			r.AuthorEmail,
+			databaseTime(r.Date),
+		); err != nil {
+			return fmt.Errorf("could not add revision %s to the database: %w", r.ShortId, err)
+		}
+	}
+
+	return nil
+}
+
+func writeHome(config *bockConfig) error {
+	homeName := config.site.Home + ".md"
+	homePath := config.articleRoot + "/" + homeName
+	_, h_err := fs.Stat(config.articles, homeName)
 
 	if h_err != nil {
-		fmt.Println("Could not find Home.md... making one.")
-		writeFile(config.articleRoot+"/Home.md", []byte("(You need to make a `Home.md` here!)\n"))
+		fmt.Fprintln(config.log, "Could not find "+homeName+"... making one.")
+
+		// Only for this build. We never write to the article root.
+		config.articles = layeredFS{
+			upper: fstest.MapFS{homeName: &fstest.MapFile{
+				Data:    []byte("(You need to make a `" + homeName + "` here!)\n"),
+				Mode:    0o644,
+				ModTime: time.Now(),
+			}},
+			lower: config.articles,
+		}
 	}
 
-	f, _ := os.Stat(homePath)
+	f, _ := fs.Stat(config.articles, homeName)
 	e := getEntityInfo(config, f, homePath)
-	writeArticle(homePath, config, *e, nil)
+
+	queue := []job{{
+		name: homeName,
+		run:  func() jobResult { return writeArticle(homePath, config, *e, nil) },
+	}}
+
+	return runWithProgress("Writing "+config.site.HomeURI, queue, config)
+}
+
+func writeArchive(config *bockConfig) error {
+	html, err := renderArchive(config)
+	if err != nil {
+		return err
+	}
+
+	return writeFile("/archive/index.html", []byte(html), config)
+}
+
+func writeRecentChanges(config *bockConfig) error {
+	changes, err := makeListOfRecentChanges(config)
+	if err != nil {
+		return fmt.Errorf("could not get recent changes: %w", err)
+	}
+
+	html, err := renderRecentChanges(changes, config)
+	if err != nil {
+		return err
+	}
+
+	if err := writePage("/recent", html, changes, config); err != nil {
+		return err
+	}
+
+	atom, err := renderAtomFeed(changes, config)
+	if err != nil {
+		return fmt.Errorf("could not make the Atom feed: %w", err)
+	}
+
+	if err := writeFile("/feed.atom", atom, config); err != nil {
+		return err
+	}
+
+	rss, err := renderRSSFeed(changes, config)
+	if err != nil {
+		return fmt.Errorf("could not make the RSS feed: %w", err)
+	}
+
+	return writeFile("/feed.rss", rss, config)
+}
+
+func writeTagList(config *bockConfig) error {
+	html, err := renderTagList(config)
+	if err != nil {
+		return err
+	}
+
+	return writePage("/tags", html, config.listOfTags, config)
 }
 
-func writeArchive(config *BockConfig) {
-	html := renderArchive(config)
-	writeFile(config.outputFolder+"/archive/index.html", []byte(html))
+func writeTag(tag tag, config *bockConfig) error {
+	html, err := renderTag(tag, config)
+	if err != nil {
+		return err
+	}
+
+	return writePage(tag.URI, html, tag, config)
 }
 
-func writeFolder(absolutePath string, config *BockConfig) {
+func writeFolder(absolutePath string, config *bockConfig) error {
 	relativePath := makeRelativePath(absolutePath, config.articleRoot)
 	pathFragments := strings.Split(relativePath, "/")
 
-	folder := (*config.entityTree)[0]
+	folderEntity := (*config.entityTree)[0]
 	var folderIndex int
 	var folderName string
-	var folders []HierarchicalEntity
-	var articles []HierarchicalEntity
+	var folders []hierarchicalEntity
+	var articles []hierarchicalEntity
 
 	// Iterate through the list and get the children of the folder
 	for _, fragment := range pathFragments {
-		folderIndex = findChildWithName(folder.Children, fragment)
+		folderIndex = findChildWithName(folderEntity.Children, fragment)
 
 		// Else, this is the ROOT folder
 		if folderIndex != -1 {
-			folder = (*folder.Children)[folderIndex]
+			folderEntity = (*folderEntity.Children)[folderIndex]
 		}
 
 		folderName = fragment
@@ -236,9 +607,9 @@ func writeFolder(absolutePath string, config *BockConfig) {
 	}
 
 	// Make the folder's children
-	for _, f := range *folder.Children {
+	for _, f := range *folderEntity.Children {
 		if f.IsFolder {
-			folders = append(folders, HierarchicalEntity{
+			folders = append(folders, hierarchicalEntity{
 				Name: removeExtensionFrom(f.Name),
 				Type: "folder",
 				URI: makeURI(
@@ -247,7 +618,7 @@ func writeFolder(absolutePath string, config *BockConfig) {
 				),
 			})
 		} else {
-			articles = append(articles, HierarchicalEntity{
+			articles = append(articles, hierarchicalEntity{
 				Name: removeExtensionFrom(f.Name),
 				Type: "article",
 				URI: makeURI(
@@ -260,98 +631,277 @@ func writeFolder(absolutePath string, config *BockConfig) {
 
 	// Check if the folder has a readme
 	README := ""
-	if r, err := os.ReadFile(absolutePath + "/README.md"); err == nil {
-		README = string(r)
+	if r, err := fs.ReadFile(config.articles, path.Join(articleFileName(absolutePath, config), "README.md")); err == nil {
+		_, body, _ := parseFrontmatter(r)
+		README = string(body)
 	}
 
 	// Make the folder struct and render it.
-	html := renderFolder(
-		Folder{
+	html, err := renderFolder(
+		folder{
 			ID:    makeID(absolutePath),
 			URI:   makeURI(absolutePath, config.articleRoot),
 			Title: folderName,
-			Children: Children{
+			Children: children{
 				Articles: articles,
 				Folders:  folders,
 			},
 			Hierarchy: makeHierarchy(absolutePath, config.articleRoot),
 			README:    README,
-		})
+		},
+		config,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return writePage(makeFolderURI(absolutePath, config), html, folderEntity, config)
+}
+
+// Write every article, folder, and tag. Problems with the database stop
+// everything. Problems with a single entity are up to `config.keepGoing`.
+func writeEntities(config *bockConfig) error {
+	tx, err := config.database.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(upsertArticleStatement)
+	if err != nil {
+		return err
+	}
+
+	defer stmt.Close()
+
+	revisionStmt, err := tx.Prepare(insertRevisionStatement)
+	if err != nil {
+		return err
+	}
+
+	defer revisionStmt.Close()
+
+	deleteHeadingsStmt, err := tx.Prepare(deleteHeadingsStatement)
+	if err != nil {
+		return err
+	}
+
+	defer deleteHeadingsStmt.Close()
+
+	headingStmt, err := tx.Prepare(insertHeadingStatement)
+	if err != nil {
+		return err
+	}
+
+	defer headingStmt.Close()
+
+	statements := &articleStatements{
+		article:        stmt,
+		revision:       revisionStmt,
+		deleteHeadings: deleteHeadingsStmt,
+		heading:        headingStmt,
+	}
 
-	// Small little local helper to keep things short
-	_writeFolder := func(isRoot bool) {
-		prefix := config.outputFolder + makeURI(absolutePath, config.articleRoot)
-		if isRoot {
-			prefix += "/ROOT"
+	// Tags, links, and folders are cheap to recreate
+	for _, table := range []string{"tags", "links", "folders"} {
+		if _, d_err := tx.Exec(`DELETE FROM ` + table); d_err != nil {
+			return fmt.Errorf("could not clear %s: %w", table, d_err)
 		}
+	}
 
-		writeFile(prefix+"/index.html", []byte(html))
+	tagStmt, err := tx.Prepare(`
+    INSERT OR IGNORE INTO tags (
+      article_id,
+      tag
+    )
+    VALUES (?, ?)
+  `)
+	if err != nil {
+		return err
+	}
+
+	defer tagStmt.Close()
 
-		if config.meta.GenerateJSON {
-			jsonData, _ := jsonMarshal(folder)
-			writeFile(prefix+"/index.json", jsonData)
+	for _, e := range *config.listOfArticles {
+		for _, tag := range e.Tags {
+			if _, t_err := tagStmt.Exec(makeID(e.path), tag); t_err != nil {
+				return fmt.Errorf("could not tag '%s' with '%s': %w", e.RelativePath, tag, t_err)
+			}
 		}
 	}
 
-	if absolutePath == config.articleRoot {
-		_writeFolder(true)
-	} else {
-		_writeFolder(false)
+	linkStmt, err := tx.Prepare(`
+    INSERT OR IGNORE INTO links (
+      source_id,
+      target_id
+    )
+    VALUES (?, ?)
+  `)
+	if err != nil {
+		return err
 	}
-}
 
-func writeEntities(config *BockConfig) {
-	tx, _ := config.database.Begin()
-	stmt, _ := tx.Prepare(`
-    INSERT INTO articles (
+	defer linkStmt.Close()
+
+	// Links to articles that don't exist yet aren't stored
+	for source, targets := range config.links.outgoing {
+		for _, target := range targets {
+			if strings.HasPrefix(target, "?") {
+				continue
+			}
+
+			if _, l_err := linkStmt.Exec(config.links.ids[source], config.links.ids[target]); l_err != nil {
+				return fmt.Errorf("could not link '%s' to '%s': %w", source, target, l_err)
+			}
+		}
+	}
+
+	folderStmt, err := tx.Prepare(`
+    INSERT OR IGNORE INTO folders (
       id,
-      content,
-      modified,
-      title,
+      parent_id,
+      name,
+      path,
       uri
     )
     VALUES (?, ?, ?, ?, ?)
   `)
+	if err != nil {
+		return err
+	}
 
-	defer stmt.Close()
+	defer folderStmt.Close()
+
+	for _, f := range *config.listOfFolders {
+		var parentID interface{}
+		name := "Root"
+
+		if f != config.articleRoot {
+			parentID = makeID(path.Dir(f))
+			name = path.Base(f)
+		}
+
+		if _, f_err := folderStmt.Exec(
+			makeID(f),
+			parentID,
+			name,
+			makeRelativePath(f, config.articleRoot),
+			makeFolderURI(f, config),
+		); f_err != nil {
+			return fmt.Errorf("could not add the folder '%s': %w", f, f_err)
+		}
+	}
 
-	// Process entities in simple waitgroups... for now. This creates as many
-	// coroutines as articles and gets really slow on machines with low memory.
-	entityWaitGroup := new(sync.WaitGroup)
+	queue := []job{}
 
-	fmt.Println("Will write", config.meta.ArticleCount, "articles")
+	fmt.Fprintln(config.log, "Will write", config.meta.ArticleCount, "articles")
 	for _, e := range *config.listOfArticles {
-		entityWaitGroup.Add(1)
+		e := e
+		queue = append(queue, job{
+			name: e.RelativePath,
+			run:  func() jobResult { return writeArticle(e.path, config, e, statements) },
+		})
+	}
 
-		go func(e Entity, stmt *sql.Stmt, config *BockConfig) {
-			defer entityWaitGroup.Done()
-			writeArticle(e.path, config, e, stmt)
-		}(e, stmt, config)
+	fmt.Fprintln(config.log, "Will write", config.meta.FolderCount, "folders")
+	for _, f := range *config.listOfFolders {
+		f := f
+		queue = append(queue, job{
+			name: makeFolderURI(f, config),
+			run: func() jobResult {
+				if err := writeFolder(f, config); err != nil {
+					return jobResult{err: err}
+				}
+
+				return jobResult{folders: 1}
+			},
+		})
 	}
 
-	fmt.Println("Will write", config.meta.FolderCount, "folders")
-	for _, e := range *config.listOfFolders {
-		entityWaitGroup.Add(1)
+	fmt.Fprintln(config.log, "Will write", config.meta.TagCount, "tags")
+	for _, t := range *config.listOfTags {
+		t := t
+		queue = append(queue, job{
+			name: t.Name,
+			run: func() jobResult {
+				if err := writeTag(t, config); err != nil {
+					return jobResult{err: err}
+				}
+
+				return jobResult{tags: 1}
+			},
+		})
+	}
+
+	if err := runWithProgress("Writing entities", queue, config); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(config.log, "Finished writing all entities")
+
+	return tx.Commit()
+}
+
+// Run jobs on the worker pool, keeping track of what they did and reporting
+// progress as we go. Workers read `config.meta` while rendering so it's only
+// updated once they're all done. Articles that couldn't be written are left
+// out of the manifest so the next build tries them again. Unless we're keeping
+// going, the first failure stops any more jobs from starting and is returned.
+func runWithProgress(label string, queue []job, config *bockConfig) error {
+	p := newProgress(label, len(queue), config.log)
+	var firstFailure error
+
+	runJobs(config.ctx, queue, config.jobs, func(result jobResult) bool {
+		config.stats.collect(result)
+		p.expect(len(result.next))
+		p.report(result)
+
+		if result.err == nil {
+			return true
+		}
+
+		if result.article != "" {
+			forgetInManifest(result.article, config)
+		}
+
+		if firstFailure == nil {
+			firstFailure = BuildError{Name: result.name, Err: result.err}
+		}
+
+		return config.keepGoing
+	})
+
+	p.finish()
 
-		go func(e string, stmt *sql.Stmt, config *BockConfig) {
-			defer entityWaitGroup.Done()
-			writeFolder(e, config)
-		}(e, stmt, config)
+	config.meta.RevisionCount = int(config.stats.revisions.Load())
+
+	if err := config.ctx.Err(); err != nil {
+		return err
 	}
 
-	entityWaitGroup.Wait()
+	if config.keepGoing {
+		return nil
+	}
 
-	fmt.Printf("\033[2K\r")
-	fmt.Println("Finished writing all entities")
-	tx.Commit()
+	return firstFailure
 }
 
-func writeTree(config *BockConfig) {
-	s, _ := jsonMarshal(config.entityTree)
-	writeFile(config.outputFolder+"/tree.json", s)
+func writeTree(config *bockConfig) error {
+	s, err := jsonMarshal(config.entityTree)
+	if err != nil {
+		return err
+	}
+
+	return writeFile("/tree.json", s, config)
 }
 
-func writeRandom(config *BockConfig) {
-	html := renderRandom(config)
-	writeFile(config.outputFolder+"/random/index.html", []byte(html))
+func writeRandom(config *bockConfig) error {
+	html, err := renderRandom(config)
+	if err != nil {
+		return err
+	}
+
+	return writeFile("/random/index.html", []byte(html), config)
 }